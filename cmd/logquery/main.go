@@ -0,0 +1,378 @@
+// Command logquery reads the daily log files written by logger.FileWriter in one or more directories, filters the
+// messages by time, level, namespace and text, and prints them merged chronologically.
+//
+//	logquery -prefix app- -since 2024-05-01 -until '2024-05-02 12:00:00' -level warn -filter '^exch' /var/log/app
+//	logquery -follow -grep 'order (sent|filled)' /var/log/app /var/log/gateway
+//
+// Lines in the simple and JSON formats (logfmt too) are parsed; lines that follow a message without being one, like
+// the stack of an ERROR message, are kept with it. With -follow, new messages are printed as they are written, across
+// the day change and size rotation of the files.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+var levelColors = map[logger.LogLevel]string{
+	logger.LogLevelDebug: "{cyan}",
+	logger.LogLevelInfo:  "",
+	logger.LogLevelWarn:  "{yellow}",
+	logger.LogLevelError: "{red}",
+	logger.LogLevelFatal: "{red+b}",
+}
+
+// timeLayouts are the layouts accepted by -since and -until, in UTC unless they have a zone
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// entry is a log message read from a file: its record, and its lines as written
+type entry struct {
+	rec  logger.LogRecord
+	text string
+}
+
+type query struct {
+	filter    logger.FilterFunc
+	text      logger.FilterFunc // on the message and the fields
+	minLevel  logger.LogLevel
+	nsLevels  logger.NamespaceLevels
+	since     time.Time // zero for no limit
+	until     time.Time // zero for no limit
+	color     bool
+	formatter logger.Formatter // nil to print the lines as written
+	out       io.Writer
+}
+
+func main() {
+	prefix := flag.String("prefix", "", "log file name prefix")
+	suffix := flag.String("suffix", ".log", "log file name suffix")
+	rawSince := flag.String("since", "", "start time: a date, a time like \"2006-01-02 15:04:05\" (UTC) or RFC3339, or a duration before now like 2h")
+	rawUntil := flag.String("until", "", "end time, like -since")
+	rawLevel := flag.String("level", "debug", "minimum log level")
+	rawLevels := flag.String("levels", "", `per-namespace minimum levels, e.g. "WS=debug, *=info"`)
+	include := flag.String("filter", "", "namespace filter (substring or regular expression)")
+	exclude := flag.String("exclude", "", "namespace exclusion filter (substring or regular expression)")
+	grep := flag.String("grep", "", "message filter (substring or regular expression), fields included")
+	follow := flag.Bool("follow", false, "wait for new messages; without -since, only new messages are printed")
+	poll := flag.Duration("poll", 500*time.Millisecond, "file polling interval with -follow")
+	rawFormat := flag.String("format", "", "print the messages in this format (simple, json, logfmt) instead of as written")
+	noColor := flag.Bool("nocolor", false, "do not colorize the output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] directory...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now().UTC()
+	q := &query{
+		filter:   logger.FilterMatchAll,
+		text:     logger.FilterMatchAll,
+		minLevel: logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		color:    !*noColor,
+		out:      os.Stdout,
+	}
+	var err error
+	if q.since, err = parseTime(*rawSince, now); err != nil {
+		fatalf("invalid -since: %v", err)
+	}
+	if q.until, err = parseTime(*rawUntil, now); err != nil {
+		fatalf("invalid -until: %v", err)
+	}
+	if *follow && q.since.IsZero() {
+		q.since = now
+	}
+	if *include != "" {
+		q.filter = logger.Filter(*include)
+	}
+	if *exclude != "" {
+		q.filter = logger.And(q.filter, logger.Not(*exclude))
+	}
+	if *grep != "" {
+		q.text = logger.Filter(*grep)
+	}
+	if *rawLevels != "" {
+		levels, err := logger.ParseNamespaceLevels(*rawLevels)
+		if err != nil {
+			fatalf("invalid -levels: %v", err)
+		}
+		q.nsLevels = levels
+	}
+	switch *rawFormat {
+	case "":
+	case "simple":
+		q.formatter = logger.NewSimpleFormatter(false, false)
+	case "json":
+		q.formatter = logger.NewJsonFormatter()
+	case "logfmt":
+		q.formatter = logger.NewLogfmtFormatter(false)
+	default:
+		fatalf("invalid -format %q", *rawFormat)
+	}
+
+	sources := make([]*source, 0, flag.NArg())
+	for _, dir := range flag.Args() {
+		sources = append(sources, newSource(dir, *prefix, *suffix, q.since, q.until))
+	}
+	defer func() {
+		for _, src := range sources {
+			src.close()
+		}
+	}()
+
+	q.merge(sources)
+	if !*follow {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(*poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.merge(sources)
+		case <-signals:
+			return
+		}
+	}
+}
+
+// parseTime parses a -since or -until value; zero time if empty
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// merge prints the messages available in the sources, oldest first, until they are all read
+func (q *query) merge(sources []*source) {
+	heads := make([]*entry, len(sources))
+	for {
+		oldest := -1
+		for i, src := range sources {
+			if heads[i] == nil {
+				heads[i] = src.next()
+			}
+			if heads[i] != nil && (oldest < 0 || heads[i].rec.Time.Before(heads[oldest].rec.Time)) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			return
+		}
+		if q.accepts(heads[oldest].rec) {
+			q.print(*heads[oldest])
+		}
+		heads[oldest] = nil
+	}
+}
+
+func (q *query) accepts(rec logger.LogRecord) bool {
+	if (!q.since.IsZero() && rec.Time.Before(q.since)) || (!q.until.IsZero() && rec.Time.After(q.until)) {
+		return false
+	}
+	if !q.filter(rec.Namespace) {
+		return false
+	}
+	minLevel := q.minLevel
+	if level, ok := q.nsLevels.Lookup(rec.Namespace); ok {
+		minLevel = level
+	}
+	if rec.Level < minLevel {
+		return false
+	}
+	if q.text(rec.Message) {
+		return true
+	}
+	for _, f := range rec.Fields {
+		if q.text(fmt.Sprintf("%s=%v", f.Key, f.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *query) print(e entry) {
+	txt := e.text
+	if q.formatter != nil {
+		txt = logger.FormatLogRecord(q.formatter, e.rec)
+	}
+	if color := levelColors[e.rec.Level]; q.color && color != "" {
+		txt = logger.ExpandAnsi(color) + txt + logger.ExpandAnsi("{reset}")
+	}
+	fmt.Fprintln(q.out, txt)
+}
+
+// source reads the messages of the log files of a directory, in the order of the files
+type source struct {
+	dir, prefix, suffix string
+	since, until        string // days of the files to read, "" for no limit
+
+	current  logger.LogFile // file being read, zero if none yet
+	file     *os.File
+	reader   *bufio.Reader
+	closer   io.Closer // gzip reader, if any
+	partial  string    // line not terminated yet
+	draining bool      // the file won't grow anymore
+	pending  *entry    // message waiting for its continuation lines
+	last     time.Time // time of the last message, for lines that can't be parsed
+}
+
+func newSource(dir, prefix, suffix string, since, until time.Time) *source {
+	src := &source{dir: dir, prefix: prefix, suffix: suffix}
+	if !since.IsZero() {
+		src.since = since.Format("2006-01-02")
+	}
+	if !until.IsZero() {
+		src.until = until.Format("2006-01-02")
+	}
+	return src
+}
+
+// next returns the next message available, or nil if there is none for now
+func (src *source) next() *entry {
+	for {
+		if src.reader == nil && !src.openNext() {
+			return src.flush()
+		}
+		line, err := src.reader.ReadString('\n')
+		if err == nil {
+			line, src.partial = src.partial+line, ""
+		} else {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", src.current.Path, err)
+				src.draining = true
+			}
+			// the rest of the line is read once it is complete, unless the file is done
+			src.partial += line
+			if !src.draining && !src.current.Compressed && !src.hasNewerFile() {
+				return src.flush()
+			}
+			if !src.draining {
+				// read what was written before the writer moved on
+				src.draining = true
+				continue
+			}
+			line, src.partial = src.partial, ""
+			src.closeFile()
+			if line == "" {
+				continue
+			}
+		}
+		if e := src.add(strings.TrimRight(line, "\r\n")); e != nil {
+			return e
+		}
+	}
+}
+
+// add adds a line to the pending message; returns the previous message if line starts a new one
+func (src *source) add(line string) *entry {
+	if logger.IsFileWriterMarker(line) {
+		return nil
+	}
+	rec, err := logger.ParseLogLine(line)
+	if err != nil {
+		if src.pending == nil {
+			src.pending = &entry{rec: logger.LogRecord{Time: src.last, Level: logger.LogLevelInfo, Message: line}, text: line}
+			return nil
+		}
+		src.pending.text += "\n" + line
+		src.pending.rec.Message += "\n" + line
+		return nil
+	}
+	src.last = rec.Time
+	prev := src.pending
+	src.pending = &entry{rec: rec, text: line}
+	return prev
+}
+
+// flush returns the pending message; a logger writes a message and its continuation lines at once
+func (src *source) flush() *entry {
+	prev := src.pending
+	src.pending = nil
+	return prev
+}
+
+// openNext opens the first file after the current one in the range of days; returns false if there is none
+func (src *source) openNext() bool {
+	for _, lf := range logger.ListLogFiles(src.dir, src.prefix, src.suffix) {
+		if (src.current != logger.LogFile{} && !src.current.Before(lf)) || (src.since != "" && lf.Day < src.since) ||
+			(src.until != "" && lf.Day > src.until) {
+			continue
+		}
+		file, err := os.Open(lf.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", lf.Path, err)
+			src.current = lf
+			continue
+		}
+		var r io.Reader = file
+		if lf.Compressed {
+			zr, err := gzip.NewReader(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", lf.Path, err)
+				file.Close()
+				src.current = lf
+				continue
+			}
+			r, src.closer = zr, zr
+		}
+		src.current, src.file, src.reader = lf, file, bufio.NewReader(r)
+		return true
+	}
+	return false
+}
+
+// hasNewerFile reports whether the writer moved on from the current file, so that it won't grow anymore
+func (src *source) hasNewerFile() bool {
+	for _, lf := range logger.ListLogFiles(src.dir, src.prefix, src.suffix) {
+		if src.current.Before(lf) {
+			return true
+		}
+	}
+	return false
+}
+
+func (src *source) closeFile() {
+	if src.closer != nil {
+		src.closer.Close()
+		src.closer = nil
+	}
+	if src.file != nil {
+		src.file.Close()
+		src.file = nil
+	}
+	src.reader, src.draining = nil, false
+}
+
+func (src *source) close() {
+	src.closeFile()
+}
+
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name string, lines ...string) {
+	require.NoError(t, os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+}
+
+func appendFile(t *testing.T, name string, lines ...string) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func TestQuery(t *testing.T) {
+	app, gw := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(app, "app-2021-02-02.log"),
+		"2021-02-02 23:59:59.000 (app) [ERROR]: before the range")
+	writeFile(t, filepath.Join(app, "app-2021-02-03.log"),
+		"2021-02-03 09:00:00.000 (app) [INFO]: started",
+		"2021-02-03 09:00:02.000 (app) [ERROR]: order rejected",
+		"  at main.go:42",
+		"======",
+		"2021-02-03 09:00:04.000 (app) [DEBUG]: below the level")
+	writeFile(t, filepath.Join(app, "other-2021-02-03.log"),
+		"2021-02-03 09:00:01.000 (app) [INFO]: other prefix")
+	writeFile(t, filepath.Join(gw, "app-2021-02-03.log"),
+		`{"severity":"WARN","time":1612342801000000000,"context":"WS","message":"reconnecting","attempt":2}`,
+		"2021-02-03 09:00:03.000 (_internal) [INFO]: excluded")
+
+	since, err := parseTime("2021-02-03", time.Now())
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	q := &query{
+		filter:   logger.And(logger.FilterMatchAll, logger.Not("^_")),
+		text:     logger.FilterMatchAll,
+		minLevel: logger.LogLevelInfo,
+		since:    since,
+		out:      out,
+	}
+	q.merge([]*source{newSource(app, "app-", ".log", q.since, q.until), newSource(gw, "app-", ".log", q.since, q.until)})
+	assert.Equal(t, "2021-02-03 09:00:00.000 (app) [INFO]: started\n"+
+		`{"severity":"WARN","time":1612342801000000000,"context":"WS","message":"reconnecting","attempt":2}`+"\n"+
+		"2021-02-03 09:00:02.000 (app) [ERROR]: order rejected\n  at main.go:42\n", out.String())
+
+	// text filter on the fields, reformatted
+	out.Reset()
+	q.text = logger.Filter("attempt=2")
+	q.formatter = logger.NewSimpleFormatter(false, false)
+	q.merge([]*source{newSource(app, "app-", ".log", q.since, q.until), newSource(gw, "app-", ".log", q.since, q.until)})
+	assert.Equal(t, "2021-02-03 09:00:01.000 (WS) [WARN]: reconnecting attempt=2\n", out.String())
+}
+
+func TestQueryFollow(t *testing.T) {
+	dir := t.TempDir()
+	today := filepath.Join(dir, "2021-02-03.log")
+	writeFile(t, today, "2021-02-03 23:59:58.000 (app) [INFO]: first")
+
+	out := &bytes.Buffer{}
+	q := &query{filter: logger.FilterMatchAll, text: logger.FilterMatchAll, out: out}
+	sources := []*source{newSource(dir, "", ".log", q.since, q.until)}
+	defer sources[0].close()
+	q.merge(sources)
+	assert.Equal(t, "2021-02-03 23:59:58.000 (app) [INFO]: first\n", out.String())
+
+	// a line written in two parts, then the file reopened by a restarted writer
+	out.Reset()
+	file, err := os.OpenFile(today, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString("2021-02-03 23:59:59.000 (app) [INFO]: sec")
+	require.NoError(t, err)
+	q.merge(sources)
+	assert.Empty(t, out.String())
+	_, err = file.WriteString("ond\n======\n2021-02-03 23:59:59.500 (app) [INFO]: restarted\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	q.merge(sources)
+	assert.Equal(t, "2021-02-03 23:59:59.000 (app) [INFO]: second\n2021-02-03 23:59:59.500 (app) [INFO]: restarted\n", out.String())
+
+	// the last lines of the day are read before moving to the next day
+	out.Reset()
+	appendFile(t, today, "2021-02-03 23:59:59.900 (app) [INFO]: last")
+	writeFile(t, filepath.Join(dir, "2021-02-04.log"), "2021-02-04 00:00:00.100 (app) [INFO]: next day")
+	q.merge(sources)
+	assert.Equal(t, "2021-02-03 23:59:59.900 (app) [INFO]: last\n2021-02-04 00:00:00.100 (app) [INFO]: next day\n", out.String())
+
+	out.Reset()
+	appendFile(t, filepath.Join(dir, "2021-02-04.log"), "2021-02-04 00:00:01.000 (app) [INFO]: more")
+	q.merge(sources)
+	assert.Equal(t, "2021-02-04 00:00:01.000 (app) [INFO]: more\n", out.String())
+}
@@ -0,0 +1,76 @@
+// Command logverify verifies log files written by a logger.FileWriter in the signed mode against the ed25519 public
+// key of their signing key, see logger.VerifySignedLog.
+//
+//	logverify -keyfile public.pem /var/log/trading/2024-05-01.log /var/log/trading/2024-05-02.log.gz
+//
+// The files are given in the order they were written: each must continue the last checkpoint of the previous one, so
+// that a file or the chains at the end of a file can't be removed unnoticed. It exits with status 1 if a file was
+// altered or does not continue the previous one, or if its checkpoints were not signed with the key. Lines written after
+// the last checkpoint of a file, e.g. by a process that crashed, can't be verified: they fail the verification too,
+// unless -allow-unsigned is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewelkin/trilib/utils"
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+func main() {
+	rawKey := flag.String("key", "", "base64-coded public key")
+	keyFile := flag.String("keyfile", "", "public key file, PEM format")
+	allowUnsigned := flag.Bool("allow-unsigned", false, "accept lines after the last checkpoint of a file, e.g. after a crash")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s (-key key | -keyfile public.pem) [-allow-unsigned] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || (*rawKey == "") == (*keyFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var publicKey *[32]byte
+	var err error
+	if *keyFile != "" {
+		publicKey, err = utils.ReadPemPublicKey(*keyFile)
+	} else {
+		publicKey, err = utils.DecodePublicKey(*rawKey)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid public key: %v\n", err)
+		os.Exit(2)
+	}
+
+	failed := false
+	var prev *logger.SignedLogReport
+	for _, filename := range flag.Args() {
+		report, err := logger.VerifySignedLogFile(filename, publicKey)
+		switch {
+		case err != nil:
+			fmt.Printf("%s: FAILED: %v\n", filename, err)
+			failed = true
+			prev = nil
+			continue
+		case prev != nil && !report.Continues(*prev):
+			fmt.Printf("%s: FAILED: does not continue %s, files or chains were removed\n", filename, prev.File)
+			failed = true
+		case report.Unsigned() > 0 && !*allowUnsigned:
+			fmt.Printf("%s: FAILED: %d lines after the last checkpoint are not signed\n", filename, report.Unsigned())
+			failed = true
+		default:
+			fmt.Printf("%s: OK: %d chains, %d checkpoints, %d lines signed\n",
+				filename, report.Chains, report.Checkpoints, report.Signed)
+			if report.Unsigned() > 0 {
+				fmt.Printf("%s: WARNING: %d lines after the last checkpoint are not signed\n", filename, report.Unsigned())
+			}
+		}
+		prev = &report
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
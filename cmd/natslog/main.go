@@ -0,0 +1,176 @@
+// Command natslog subscribes to NATS subjects carrying logs published by logger outputs, and prints them, filtered by
+// namespace and level, and optionally collects them into log files.
+//
+//	natslog -url nats://localhost:4222 -level info -exclude '^_' -out /var/log/collected 'logs.>'
+//
+// Lines in the simple, JSON, logfmt and GELF formats are parsed; other lines are kept as INFO messages in the
+// namespace of their subject.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+	"github.com/nats-io/nats.go"
+)
+
+var levelColors = map[logger.LogLevel]string{
+	logger.LogLevelDebug: "{cyan}",
+	logger.LogLevelInfo:  "",
+	logger.LogLevelWarn:  "{yellow}",
+	logger.LogLevelError: "{red}",
+	logger.LogLevelFatal: "{red+b}",
+}
+
+type collector struct {
+	filter      logger.FilterFunc
+	minLevel    logger.LogLevel
+	nsLevels    logger.NamespaceLevels
+	showSubject bool
+	color       bool
+	quiet       bool
+	formatter   logger.Formatter
+	fileWriter  *logger.FileWriter
+}
+
+func main() {
+	url := flag.String("url", nats.DefaultURL, "NATS server URL")
+	seed := flag.String("seed", "", "NATS nkey seed file")
+	rawLevel := flag.String("level", "debug", "minimum log level")
+	rawLevels := flag.String("levels", "", `per-namespace minimum levels, e.g. "WS=debug, *=info"`)
+	include := flag.String("filter", "", "namespace filter (substring or regular expression)")
+	exclude := flag.String("exclude", "", "namespace exclusion filter (substring or regular expression)")
+	outDir := flag.String("out", "", "directory to collect the logs into, in daily files")
+	prefix := flag.String("prefix", "", "collected log file name prefix")
+	suffix := flag.String("suffix", ".log", "collected log file name suffix")
+	maxSize := flag.Int64("maxsize", 0, "collected log file size in MB after which a new segment is started")
+	compress := flag.Bool("compress", false, "compress the closed collected log files")
+	showSubject := flag.Bool("subject", false, "add the NATS subject to each log as a field")
+	noColor := flag.Bool("nocolor", false, "do not colorize the output")
+	quiet := flag.Bool("quiet", false, "do not print the logs, only collect them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] subject...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &collector{
+		filter:      logger.FilterMatchAll,
+		minLevel:    logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		showSubject: *showSubject,
+		color:       !*noColor,
+		quiet:       *quiet,
+		formatter:   logger.NewSimpleFormatter(false, false),
+	}
+	if *include != "" {
+		c.filter = logger.Filter(*include)
+	}
+	if *exclude != "" {
+		c.filter = logger.And(c.filter, logger.Not(*exclude))
+	}
+	if *rawLevels != "" {
+		levels, err := logger.ParseNamespaceLevels(*rawLevels)
+		if err != nil {
+			fatalf("invalid -levels: %v", err)
+		}
+		c.nsLevels = levels
+	}
+	if *outDir != "" {
+		fileWriter, err := logger.NewFileWriterEx(*outDir, prefix, suffix, false, logger.FileWriterOptions{
+			MaxSize:  *maxSize * 1024 * 1024,
+			Compress: *compress,
+		})
+		if err != nil {
+			fatalf("failed to create file writer: %v", err)
+		}
+		c.fileWriter = fileWriter
+		defer fileWriter.Close()
+	}
+
+	var natsOpts []nats.Option
+	natsOpts = append(natsOpts, nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if *seed != "" {
+		nkeyOpt, err := nats.NkeyOptionFromSeed(*seed)
+		if err != nil {
+			fatalf("unable to get NATS seed from %s: %v", *seed, err)
+		}
+		natsOpts = append(natsOpts, nkeyOpt)
+	}
+	nc, err := nats.Connect(*url, natsOpts...)
+	if err != nil {
+		fatalf("unable to connect to NATS %s: %v", *url, err)
+	}
+	defer nc.Close()
+
+	msgs := make(chan *nats.Msg, 4096)
+	for _, subject := range flag.Args() {
+		if _, err := nc.ChanSubscribe(subject, msgs); err != nil {
+			fatalf("unable to subscribe to %s: %v", subject, err)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case msg := <-msgs:
+			c.handle(msg.Subject, string(msg.Data))
+		case <-signals:
+			return
+		}
+	}
+}
+
+// handle parses, filters and writes a log line received on subject
+func (c *collector) handle(subject, line string) {
+	rec, err := logger.ParseLogLine(line)
+	if err != nil {
+		rec = logger.LogRecord{Time: time.Now().UTC(), Level: logger.LogLevelInfo, Namespace: subject, Message: strings.TrimRight(line, "\r\n")}
+	}
+	if !c.accepts(rec) {
+		return
+	}
+	if c.showSubject {
+		rec.Fields = append(rec.Fields, logger.F("subject", subject))
+	}
+
+	txt := logger.FormatLogRecord(c.formatter, rec)
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.Write([]byte(txt + "\n")); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write log file: %v\n", err)
+		}
+	}
+	if c.quiet {
+		return
+	}
+	if color := levelColors[rec.Level]; c.color && color != "" {
+		txt = logger.ExpandAnsi(color) + txt + logger.ExpandAnsi("{reset}")
+	}
+	fmt.Println(txt)
+}
+
+func (c *collector) accepts(rec logger.LogRecord) bool {
+	if !c.filter(rec.Namespace) {
+		return false
+	}
+	minLevel := c.minLevel
+	if level, ok := c.nsLevels.Lookup(rec.Namespace); ok {
+		minLevel = level
+	}
+	return rec.Level >= minLevel
+}
+
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
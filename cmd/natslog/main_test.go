@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	dir := t.TempDir()
+	prefix, suffix := "collected-", ".log"
+	fileWriter, err := logger.NewFileWriter(dir, &prefix, &suffix, false)
+	require.NoError(t, err)
+
+	levels, err := logger.ParseNamespaceLevels("WS=warn")
+	require.NoError(t, err)
+	c := &collector{
+		filter:      logger.And(logger.FilterMatchAll, logger.Not("^_")),
+		minLevel:    logger.LogLevelInfo,
+		nsLevels:    levels,
+		showSubject: true,
+		quiet:       true,
+		formatter:   logger.NewSimpleFormatter(false, false),
+		fileWriter:  fileWriter,
+	}
+
+	c.handle("logs.a", "2021-02-03 09:47:58.901 (app) [INFO]: order sent orderId=42\n")
+	c.handle("logs.a", "2021-02-03 09:47:58.902 (app) [DEBUG]: below the level")
+	c.handle("logs.a", "2021-02-03 09:47:58.903 (_internal) [INFO]: excluded")
+	c.handle("logs.b", `{"severity":"INFO","time":1612345678904000000,"context":"WS","message":"below the namespace level"}`)
+	c.handle("logs.b", `{"severity":"ERROR","time":1612345678905000000,"context":"WS","message":"disconnected","code":1006}`)
+	c.handle("logs.c", "not a log line")
+	require.NoError(t, fileWriter.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "collected-*.log"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "2021-02-03 09:47:58.901 (app) [INFO]: order sent orderId=42 subject=logs.a", lines[0])
+	assert.Equal(t, "2021-02-03 09:47:58.905 (WS) [ERROR]: disconnected code=1006 subject=logs.b", lines[1])
+	assert.Contains(t, lines[2], "(logs.c) [INFO]: not a log line subject=logs.c")
+}
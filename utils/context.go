@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/andrewelkin/trilib/utils/logger"
-	"github.com/nats-io/nats.go"
-	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ContextWithCancel struct {
@@ -15,6 +16,8 @@ type ContextWithCancel struct {
 	Cancel context.CancelFunc
 	Logger logger.Logger
 	Wg     sync.WaitGroup // wait group
+
+	fatal int32 // set by shutdownOnFatal, keeps the logger running once the context is cancelled
 }
 
 var globalContext *ContextWithCancel
@@ -45,6 +48,229 @@ func filterFromConfig(cfg IConfig, defaultFilter logger.FilterFunc) logger.Filte
 	return filter
 }
 
+// namespaceLevelsFromConfig applies the "levels" config field (e.g. "WS=debug, *=info") to a log output
+func namespaceLevelsFromConfig(cfg IConfig, handle logger.OutputHandle) {
+	spec := cfg.GetString("levels")
+	if handle == nil || spec == nil || *spec == "" {
+		return
+	}
+	levels, err := logger.ParseNamespaceLevels(*spec)
+	if err != nil {
+		panic("failed to parse log levels: " + err.Error())
+	}
+	handle.SetNamespaceLevels(levels)
+}
+
+// sourceInfoFromConfig returns the source information selected by the "caller" (file:line and function of each
+// message) and "stack" (stack of ERROR and FATAL messages) config fields
+func sourceInfoFromConfig(cfg IConfig) logger.SourceInfo {
+	info := logger.SourceNone
+	if cfg.GetBoolDefault("caller", false) {
+		info |= logger.SourceCaller
+	}
+	if cfg.GetBoolDefault("stack", false) {
+		info |= logger.SourceStack
+	}
+	return info
+}
+
+// formatterFromConfig creates the formatter selected by the "format" config field: simple, json, logfmt, gelf,
+// template (with the "template" field), rfc5424 or rfc3164. The gelf and syslog formats use the "host" field, the
+// syslog formats the "appName" and "facility" fields. The time of the other formats is set by the "timeFormat",
+// "timePrecision" and "timeZone" fields, see logger.ParseTimeFormat; the colors of the simple format with ansi support
+// by the theme fields, see themeFromConfig.
+func formatterFromConfig(cfg IConfig, defaultFormat string, ansi bool, trailCR bool) logger.Formatter {
+	facility, err := logger.ParseSyslogFacility(*cfg.GetStringDefault("facility", "user"))
+	if err != nil {
+		panic("failed to create log formatter: " + err.Error())
+	}
+	timeFormat, err := logger.ParseTimeFormat(*cfg.GetStringDefault("timeFormat", ""),
+		*cfg.GetStringDefault("timePrecision", ""), *cfg.GetStringDefault("timeZone", ""))
+	if err != nil {
+		panic("failed to create log formatter: " + err.Error())
+	}
+	formatter, err := logger.NewFormatterByName(*cfg.GetStringDefault("format", defaultFormat), logger.FormatterOptions{
+		Ansi:     ansi,
+		TrailCR:  trailCR,
+		Template: *cfg.GetStringDefault("template", ""),
+		Host:     *cfg.GetStringDefault("host", ""),
+		AppName:  *cfg.GetStringDefault("appName", ""),
+		Facility: facility,
+		Time:     timeFormat,
+		Theme:    themeFromConfig(cfg),
+	})
+	if err != nil {
+		panic("failed to create log formatter: " + err.Error())
+	}
+	return formatter
+}
+
+// themeFromConfig returns the color theme set by the "theme" config field (dark, light or none), with the level colors
+// of the "levelColors" field (e.g. "warn=yellow+b, error=red") and the highlight rules of the "highlights" field, a
+// rule like "red+b=rejected|timeout" or a list of them; nil if none of them is set. See logger.Theme.
+func themeFromConfig(cfg IConfig) *logger.Theme {
+	rawName, rawLevels := *cfg.GetStringDefault("theme", ""), *cfg.GetStringDefault("levelColors", "")
+	var rawHighlights []string
+	switch raw := cfg.GetValue("highlights").(type) {
+	case string:
+		rawHighlights = append(rawHighlights, raw)
+	case []interface{}:
+		for _, item := range raw {
+			rawHighlights = append(rawHighlights, fmt.Sprint(item))
+		}
+	case []string:
+		rawHighlights = raw
+	}
+	if rawName == "" && rawLevels == "" && len(rawHighlights) == 0 {
+		return nil
+	}
+
+	theme, err := logger.ThemeByName(rawName)
+	if err != nil {
+		panic("failed to create log theme: " + err.Error())
+	}
+	if rawLevels != "" {
+		levels, err := logger.ParseLevelColors(rawLevels)
+		if err != nil {
+			panic("failed to create log theme: " + err.Error())
+		}
+		for level, color := range levels {
+			theme.Levels[level] = color
+		}
+	}
+	for _, raw := range rawHighlights {
+		if raw == "" {
+			continue
+		}
+		highlight, err := logger.ParseHighlight(raw)
+		if err != nil {
+			panic("failed to create log theme: " + err.Error())
+		}
+		theme.Highlights = append(theme.Highlights, highlight)
+	}
+	return theme
+}
+
+// redactionFromConfig applies the "redact" config field, a regular expression or a list of them masked in the log
+// messages, and the "redactFields" field, matching the names of the fields whose values are masked ("" for none)
+func redactionFromConfig(cfg IConfig, lgr *logger.AsyncLogger) {
+	var rawPatterns []string
+	switch raw := cfg.GetValue("redact").(type) {
+	case string:
+		rawPatterns = append(rawPatterns, raw)
+	case []interface{}:
+		for _, item := range raw {
+			rawPatterns = append(rawPatterns, fmt.Sprint(item))
+		}
+	case []string:
+		rawPatterns = raw
+	}
+	patterns := make([]*regexp.Regexp, 0, len(rawPatterns))
+	for _, raw := range rawPatterns {
+		if raw == "" {
+			continue
+		}
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			panic("failed to parse log redaction pattern: " + err.Error())
+		}
+		patterns = append(patterns, re)
+	}
+	if len(patterns) > 0 {
+		lgr.SetRedactPatterns(patterns...)
+	}
+
+	if cfg.GetValue("redactFields") != nil {
+		rawFields := cfg.GetString("redactFields")
+		if *rawFields == "" {
+			lgr.SetRedactFieldNames(nil)
+			return
+		}
+		re, err := regexp.Compile(*rawFields)
+		if err != nil {
+			panic("failed to parse log redaction field names: " + err.Error())
+		}
+		lgr.SetRedactFieldNames(re)
+	}
+}
+
+// samplingFromConfig applies the "sampleFirst", "sampleThereafter", "sampleInterval" (seconds) and "rateLimits"
+// (e.g. "WS=100, *=1000/2000") config fields, see logger.SamplingOptions
+func samplingFromConfig(cfg IConfig, lgr *logger.AsyncLogger) {
+	opts := logger.SamplingOptions{
+		First:      int(cfg.GetIntDefault("sampleFirst", 0)),
+		Thereafter: int(cfg.GetIntDefault("sampleThereafter", 0)),
+		Interval:   time.Duration(cfg.GetFloatDefault("sampleInterval", logger.LogSamplingInterval.Seconds()) * float64(time.Second)),
+	}
+	if spec := cfg.GetString("rateLimits"); spec != nil && *spec != "" {
+		limits, err := logger.ParseRateLimits(*spec)
+		if err != nil {
+			panic("failed to parse log rate limits: " + err.Error())
+		}
+		opts.RateLimits = limits
+	}
+	if opts.First > 0 || len(opts.RateLimits) > 0 {
+		lgr.SetSampling(opts)
+	}
+}
+
+// namespacesFromConfig applies the "namespaces" config field, the levels of dotted namespaces inherited by their
+// descendants, either as a string like "exch=warn, exch.binance=debug" or as a list of objects also routing namespaces
+// to outputs named after their type in "outputs":
+//
+//	"namespaces": [
+//		{"namespace": "exch", "level": "warn"},
+//		{"namespace": "exch.binance.ws", "level": "debug", "outputs": ["file"]}
+//	]
+//
+// See logger.AsyncLogger.SetNamespaceLevels and SetNamespaceOutputs.
+func namespacesFromConfig(cfg IConfig, lgr *logger.AsyncLogger) {
+	var levels logger.NamespaceLevels
+	var outputs logger.NamespaceOutputs
+	switch raw := cfg.GetValue("namespaces").(type) {
+	case nil:
+		return
+	case string:
+		var err error
+		if levels, err = logger.ParseNamespaceLevels(raw); err != nil {
+			panic("failed to parse log namespaces: " + err.Error())
+		}
+	case []interface{}:
+		for _, item := range raw {
+			ns, ok := item.(map[string]interface{})
+			if !ok || ns["namespace"] == nil {
+				panic(fmt.Sprintf("failed to parse log namespaces: expected {namespace, level, outputs}, got %v", item))
+			}
+			pattern := fmt.Sprint(ns["namespace"])
+			if rawLevel, ok := ns["level"]; ok {
+				spec := pattern + "=" + fmt.Sprint(rawLevel)
+				level, err := logger.ParseNamespaceLevels(spec)
+				if err != nil {
+					panic("failed to parse log namespaces: " + err.Error())
+				}
+				levels = append(levels, level...)
+			}
+			switch rawOutputs := ns["outputs"].(type) {
+			case nil:
+			case string:
+				outputs = append(outputs, logger.NamespaceOutput{Pattern: pattern, Outputs: strings.Fields(strings.ReplaceAll(rawOutputs, ",", " "))})
+			case []interface{}:
+				names := make([]string, 0, len(rawOutputs))
+				for _, name := range rawOutputs {
+					names = append(names, fmt.Sprint(name))
+				}
+				outputs = append(outputs, logger.NamespaceOutput{Pattern: pattern, Outputs: names})
+			default:
+				panic(fmt.Sprintf("failed to parse log namespaces: invalid outputs %v", rawOutputs))
+			}
+		}
+	default:
+		panic(fmt.Sprintf("failed to parse log namespaces: unexpected %T", raw))
+	}
+	lgr.SetNamespaceLevels(levels)
+	lgr.SetNamespaceOutputs(outputs)
+}
+
 // GetOrCreateGlobalContext sets a new global context with logging and cancel
 // Expects a config, which is normally would be a "Logging" section
 func GetOrCreateGlobalContext(gconfig IConfig, opts ...any) *ContextWithCancel {
@@ -78,6 +304,9 @@ func GetOrCreateGlobalContext(gconfig IConfig, opts ...any) *ContextWithCancel {
 	if ctx == nil {
 		ctx, cancel = context.WithCancel(context.Background())
 	}
+	// the logger has its own context, cancelled with ctx unless on Fatalf, so that what is logged while shutting down
+	// is written, see shutdownOnFatal
+	logCtx, stopLogger := context.WithCancel(context.Background())
 	var config IConfig
 	if gconfig != nil {
 		config = gconfig.FromKey("logger")
@@ -96,11 +325,57 @@ func GetOrCreateGlobalContext(gconfig IConfig, opts ...any) *ContextWithCancel {
 			logLevel = logger.ParseLogLevel(*tmp, logger.LogLevelDebug)
 		}
 
+		logger.LogCacheSize = int(config.GetIntDefault("cacheSize", int64(logger.LogCacheSize)))
+		logger.LogBufferSize = int(config.GetIntDefault("bufferSize", int64(logger.LogBufferSize)))
+
 		// allow the default stdout log namespace filter to be overridden by the "filter" config field
 		outputsCfg = config.FromKey("outputs")
-		globalLogger = loggerFunc(ctx, logLevel, filterFromConfig(config, defaultFilter))
+		globalLogger = loggerFunc(logCtx, logLevel, filterFromConfig(config, defaultFilter))
+
+		if asyncLogger, ok := globalLogger.(*logger.AsyncLogger); ok {
+			if dumpFile := config.GetString("cacheDumpFile"); dumpFile != nil && *dumpFile != "" {
+				asyncLogger.SetCacheDumpFile(*dumpFile)
+			}
+			// per-namespace levels of the default stdout output, e.g. levels = "WS=debug, *=info"
+			namespaceLevelsFromConfig(config, asyncLogger.Output(logger.DefaultOutputName))
+			asyncLogger.Output(logger.DefaultOutputName).SetSourceInfo(sourceInfoFromConfig(config))
+			// colors of the default stdout output, e.g. theme = "dark"
+			if theme := themeFromConfig(config); theme != nil {
+				if err := asyncLogger.SetOutputTheme(logger.DefaultOutputName, theme); err != nil {
+					panic("failed to set log theme: " + err.Error())
+				}
+			}
+
+			// what to do when the log buffer is full: block (default), drop-newest, drop-oldest, drop-below-level
+			if rawPolicy := config.GetString("backpressure"); rawPolicy != nil && *rawPolicy != "" {
+				policy, err := logger.ParseBackpressurePolicy(*rawPolicy)
+				if err != nil {
+					panic("failed to set log backpressure policy: " + err.Error())
+				}
+				rawDropLevel := config.GetStringDefault("backpressureLevel", "warn")
+				asyncLogger.SetBackpressurePolicy(policy, logger.ParseLogLevel(*rawDropLevel, logger.LogLevelWarn))
+			}
+
+			// what Errorf does after logging: panic (default) or return
+			if rawPolicy := config.GetString("errorPolicy"); rawPolicy != nil && *rawPolicy != "" {
+				policy, err := logger.ParseErrorPolicy(*rawPolicy)
+				if err != nil {
+					panic("failed to set error policy: " + err.Error())
+				}
+				asyncLogger.SetErrorPolicy(policy, nil)
+			}
+
+			// secrets masked before the messages are formatted
+			redactionFromConfig(config, asyncLogger)
+
+			// sampling and rate limiting of high-frequency logs
+			samplingFromConfig(config, asyncLogger)
+
+			// levels and outputs of dotted namespaces and their descendants
+			namespacesFromConfig(config, asyncLogger)
+		}
 	} else {
-		globalLogger = loggerFunc(ctx, logLevel, defaultFilter)
+		globalLogger = loggerFunc(logCtx, logLevel, defaultFilter)
 	}
 
 	// add additional writers, if configured
@@ -113,83 +388,45 @@ func GetOrCreateGlobalContext(gconfig IConfig, opts ...any) *ContextWithCancel {
 				panic("failed to parse output config: " + outputType)
 			}
 
-			switch strings.ToLower(outputType) {
-
-			case "nats_publisher", "natspublisher", "nats":
-				subject := cfg.GetStringDefault("subject", "default-logger-subject")
-				url := cfg.GetStringDefault("url", nats.DefaultURL)
-				filter := filterFromConfig(cfg, logger.FilterMatchAll)
-
-				rawLevel := cfg.GetStringDefault("logLevel", "debug")
-				ansi := cfg.GetBoolDefault("ansicodes", false)
-
-				if len(*subject) == 0 {
-					panic("failed to create nats logger : empty publishing subject")
-				}
-
-				var nkeyOpt nats.Option
-				nSeedFile := *cfg.GetStringDefault("natsSeed", "")
-				if len(nSeedFile) > 0 {
-					var err error
-					nkeyOpt, err = nats.NkeyOptionFromSeed(nSeedFile)
-					if err != nil {
-						panic(fmt.Sprintf("failed to create nats logger : unable to get NATS seed from %s: %v", nSeedFile, err))
-					}
-				}
-
-				nc, err := nats.Connect(*url, nkeyOpt)
-				if err != nil {
-					panic(fmt.Sprintf("failed to create nats logger : unable to connect to NATS %s: %v", *url, err))
-				}
-				globalLogger.AddOutput(filter, logger.NewNatsLogger(*subject, nc), logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug), ansi, false)
-
-			case "filewriter", "file":
-				rawLevel, path, prefix, suffix, filter, skipRepeating :=
-					cfg.GetStringDefault("logLevel", "debug"),
-					cfg.GetStringDefault("path", "/tmp/test_logs"),
-					cfg.GetStringDefault("filePrefix", ""),
-					cfg.GetStringDefault("fileSuffix", ".log"),
-					filterFromConfig(cfg, logger.FilterMatchAll),
-					cfg.GetBoolDefault("skipRepeating", true)
-
-				fileWriter, err := logger.NewFileWriter(*path, prefix, suffix, skipRepeating)
-				if err != nil {
-					panic("failed to create file writer: " + err.Error())
-				}
-
-				globalLogger.Infof(logNameSpace, "Adding log file output; filter=%s exclude=%s path=%s level=%s", *cfg.GetStringDefault("filter", ""), *cfg.GetStringDefault("exclude", ""), *path, *rawLevel)
-				globalLogger.AddOutput(
-					filter,
-					fileWriter,
-					logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug), false, true)
-
-			case "jsonstream", "jsonout", "prod":
-				rawLevel, filter :=
-					cfg.GetStringDefault("logLevel", "info"),
-					filterFromConfig(cfg, logger.FilterMatchAll)
-
-				globalLogger.Infof(logNameSpace, "Adding log json output; filter=%s exclude=%s level=%s", *cfg.GetStringDefault("filter", ""), *cfg.GetStringDefault("exclude", ""), *rawLevel)
-				globalLogger.AddOutput(
-					filter,
-					os.Stderr,
-					logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
-					false,
-					true,
-					logger.NewJsonFormatter(),
-				)
-
-			default:
-				panic("unknown log output type: " + outputType)
-			}
+			addLogOutput(globalLogger, outputType, cfg)
 		}
 	}
 
+	// optionally route log/slog through the global logger
+	captureSlogFromConfig(config, globalLogger, logLevel)
+
 	globalLogger.Infof(logNameSpace, "Creating global context with default logger level %v and namespace %v", logLevel, logNameSpace)
 	globalContext = &ContextWithCancel{
 		Context: ctx,
 		Cancel:  cancel,
 		Logger:  globalLogger,
 	}
+	go func(c *ContextWithCancel) {
+		<-c.Done()
+		if atomic.LoadInt32(&c.fatal) == 0 {
+			stopLogger()
+		}
+	}(globalContext)
+
+	// on Fatalf, cancel the global context and give the goroutines in its wait group fatalTimeout seconds to stop
+	// before exiting; 0 exits immediately
+	fatalTimeout := logger.LogFatalTimeout
+	if config != nil {
+		fatalTimeout = time.Duration(config.GetIntDefault("fatalTimeout", int64(fatalTimeout/time.Second))) * time.Second
+	}
+	if asyncLogger, ok := globalLogger.(*logger.AsyncLogger); ok && fatalTimeout > 0 {
+		asyncLogger.SetFatalHandler(globalContext.shutdownOnFatal, fatalTimeout)
+	}
 
 	return globalContext
 }
+
+// shutdownOnFatal is the fatal handler of the global logger: cancels the context and waits for the wait group. The
+// logger keeps running, so that the messages logged meanwhile are written before the process exits.
+func (c *ContextWithCancel) shutdownOnFatal(namespace, message string) {
+	atomic.StoreInt32(&c.fatal, 1)
+	if c.Cancel != nil {
+		c.Cancel()
+	}
+	c.Wg.Wait()
+}
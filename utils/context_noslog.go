@@ -0,0 +1,11 @@
+//go:build !go1.21
+
+package utils
+
+import (
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+// captureSlogFromConfig does nothing: log/slog requires go1.21
+func captureSlogFromConfig(config IConfig, lgr logger.Logger, defaultLevel logger.LogLevel) {
+}
@@ -0,0 +1,20 @@
+//go:build go1.21
+
+package utils
+
+import (
+	"log/slog"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+// captureSlogFromConfig makes the global logger the default log/slog handler if "captureSlog" is set in the logger
+// config, so that libraries logging with slog go through the namespaces, filters and outputs of the global logger
+func captureSlogFromConfig(config IConfig, lgr logger.Logger, defaultLevel logger.LogLevel) {
+	if config == nil || !config.GetBoolDefault("captureSlog", false) {
+		return
+	}
+	namespace := config.GetStringDefault("slogNamespace", "slog")
+	level := logger.ParseLogLevel(*config.GetStringDefault("slogLevel", ""), defaultLevel)
+	slog.SetDefault(slog.New(logger.NewSlogHandler(lgr, *namespace, level)))
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+func TestRedactionFromConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"logger": {"redact": ["token=(\\w+)", "\\d{16}"], "redactFields": "(?i)^pass$"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := (&Vconfig{}).ReadConfig(filename).FromKey("logger")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lgr := logger.NewAsyncLogger(ctx, logger.LogLevelFatal, logger.FilterMatchNone)
+	var buf bytes.Buffer
+	lgr.AddOutput(logger.FilterMatchAll, &buf, logger.LogLevelDebug, false, true)
+	redactionFromConfig(cfg, lgr)
+
+	lgr.Infow("test", "url ?token=abc card 1234567812345678", "pass", "p4ss", "apiKey", "visible")
+	lgr.Flush()
+
+	if got := buf.String(); !strings.Contains(got, "url ?token=*** card *** pass=*** apiKey=visible") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestNamespacesFromConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"logger": {"namespaces": [
+		{"namespace": "exch", "level": "warn"},
+		{"namespace": "exch.binance.ws", "level": "debug", "outputs": ["Memory"]}
+	]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := (&Vconfig{}).ReadConfig(filename).FromKey("logger")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lgr := logger.NewAsyncLogger(ctx, logger.LogLevelFatal, logger.FilterMatchNone)
+	var memory, other bytes.Buffer
+	lgr.AddOutput(logger.FilterMatchAll, &memory, logger.LogLevelDebug, false, true, logger.OutputName("memory"))
+	lgr.AddOutput(logger.FilterMatchAll, &other, logger.LogLevelDebug, false, true, logger.OutputName("other"))
+	namespacesFromConfig(cfg, lgr)
+
+	exch := lgr.Named("exch")
+	exch.Infof("okx", "below the level of exch")
+	exch.Warnf("okx", "warning")
+	exch.Named("binance").Debugf("ws", "routed")
+	lgr.Debugf("app", "not configured")
+	lgr.Flush()
+
+	if got := memory.String(); strings.Contains(got, "below") || !strings.Contains(got, "(exch.okx) [WARN]: warning") ||
+		!strings.Contains(got, "(exch.binance.ws) [DEBUG]: routed") || !strings.Contains(got, "not configured") {
+		t.Errorf("unexpected output %q", got)
+	}
+	if got := other.String(); strings.Contains(got, "routed") || !strings.Contains(got, "warning") {
+		t.Errorf("unexpected output of the other output %q", got)
+	}
+}
+
+func TestThemeFromConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"logger": {"theme": "light", "levelColors": "warn=yellow+b",
+		"highlights": ["red+b=rejected|timeout", "green=filled"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := (&Vconfig{}).ReadConfig(filename).FromKey("logger")
+
+	theme := themeFromConfig(cfg)
+	if theme == nil || theme.Name != "light" || theme.Levels[logger.LogLevelWarn] != "yellow+b" || len(theme.Highlights) != 2 {
+		t.Fatalf("unexpected theme %+v", theme)
+	}
+	if theme.Highlights[0].Color != "red+b" || !theme.Highlights[0].Pattern.MatchString("timeout") {
+		t.Errorf("unexpected highlight %+v", theme.Highlights[0])
+	}
+	if logger.ThemeLight.Levels[logger.LogLevelWarn] == "yellow+b" {
+		t.Errorf("the named theme was modified")
+	}
+	if err := os.WriteFile(filename, []byte(`{"logger": {"format": "simple"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if theme := themeFromConfig((&Vconfig{}).ReadConfig(filename).FromKey("logger")); theme != nil {
+		t.Errorf("unexpected theme without config %+v", theme)
+	}
+}
+
+func TestShutdownOnFatalKeepsLogging(t *testing.T) {
+	defer func() { globalContext = nil }()
+
+	var buf syncBuffer
+	var asyncLogger *logger.AsyncLogger
+	factory := func(ctx context.Context, level logger.LogLevel, filter logger.FilterFunc) logger.Logger {
+		asyncLogger = logger.NewAsyncLogger(ctx, level, logger.FilterMatchNone)
+		asyncLogger.AddOutput(logger.FilterMatchAll, &buf, logger.LogLevelDebug, false, true)
+		return asyncLogger
+	}
+	c := GetOrCreateGlobalContext(nil, factory)
+	c.Wg.Add(1)
+	go func() {
+		defer c.Wg.Done()
+		<-c.Done()
+		time.Sleep(20 * time.Millisecond) // stopping
+		c.Logger.Infof("worker", "stopped after cancel")
+	}()
+
+	c.shutdownOnFatal("app", "out of memory")
+	asyncLogger.Flush()
+	if got := buf.String(); !strings.Contains(got, "(worker) [INFO]: stopped after cancel") {
+		t.Errorf("message logged during the shutdown not written: %q", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+func TestGetOrCreateGlobalContextObserved(t *testing.T) {
+	defer func() { globalContext = nil }()
+
+	observed := logger.NewObservedLogger(logger.LogLevelDebug)
+	ctx := GetOrCreateGlobalContext(nil, observed.Factory())
+	if ctx.Logger != observed {
+		t.Fatalf("global logger is not the observed logger")
+	}
+	ctx.Logger.Warnf("test", "observed")
+	if !observed.Contains(logger.LogLevelInfo, "*", "^Creating global context") || !observed.Contains(logger.LogLevelWarn, "test", "observed") {
+		t.Errorf("unexpected records %v", observed.Records())
+	}
+}
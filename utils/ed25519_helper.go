@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"github.com/andrewelkin/trilib/utils/logger"
 	"golang.org/x/crypto/ed25519"
 	"os"
 	"strings"
@@ -37,6 +38,7 @@ func DecodePublicKey(public string) (*[32]byte, error) {
 }
 
 // DecodePrivateKey decodes base64-coded private key into ed25519 key
+// The key is registered as a secret, so that it is masked if it ever gets logged
 func DecodePrivateKey(private string) (*[64]byte, error) {
 	var prvKey [64]byte
 
@@ -50,33 +52,52 @@ func DecodePrivateKey(private string) (*[64]byte, error) {
 		return nil, fmt.Errorf("error decoding private key")
 	}
 	copy(prvKey[:], realpKkey.(ed25519.PrivateKey))
+	logger.RegisterSecret(private, base64.StdEncoding.EncodeToString(prvKey[:]))
 	return &prvKey, nil
 
 }
 
+// ReadPemPublicKey reads ed25519 public key from the file, PEM format, and decodes it
+func ReadPemPublicKey(filename string) (*[32]byte, error) {
+	pkS, err := readPem(filename, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	return DecodePublicKey(pkS)
+}
+
 // ReadPemPrivateKey reads ed25519 private key from the file, PEM format, and decodes it
+// The key is registered as a secret, see DecodePrivateKey
 func ReadPemPrivateKey(filename string) (*[64]byte, error) {
+	pkS, err := readPem(filename, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	return DecodePrivateKey(pkS)
+}
 
-	prefix := "BEGIN PRIVATE KEY-----"
-	suffix := "-----END PRIVATE KEY"
+// readPem returns the base64 body of the PEM block of the file with the label, e.g. "PRIVATE KEY"
+func readPem(filename string, label string) (string, error) {
+
+	prefix := "BEGIN " + label + "-----"
+	suffix := "-----END " + label
 	var pKey []byte
 	var err error
 
 	pKey, err = os.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("error reading file %s : %v", filename, err.Error())
+		return "", fmt.Errorf("error reading file %s : %v", filename, err.Error())
 	}
 
 	pkS := strings.Replace(string(pKey), "\n", "", -1)
 	ndx := strings.Index(pkS, prefix)
 	if ndx < 0 {
-		return nil, fmt.Errorf("error reading file %s", filename)
+		return "", fmt.Errorf("error reading file %s", filename)
 	}
 	pkS = pkS[ndx+len(prefix):]
 	ndx = strings.Index(pkS, suffix)
 	if ndx < 0 {
-		return nil, fmt.Errorf("error reading file %s", filename)
+		return "", fmt.Errorf("error reading file %s", filename)
 	}
-	pkS = pkS[:ndx]
-	return DecodePrivateKey(pkS)
+	return pkS[:ndx], nil
 }
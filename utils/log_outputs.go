@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+	"github.com/nats-io/nats.go"
+)
+
+// LogOutput is a log output created by a LogOutputFactory, added to the global logger by GetOrCreateGlobalContext
+type LogOutput struct {
+	Writer    io.Writer
+	Formatter logger.Formatter // if nil, a simple formatter using Ansi and TrailCR
+	Filter    logger.FilterFunc
+	Level     logger.LogLevel
+	Ansi      bool
+	TrailCR   bool
+	Options   []interface{} // additional AddOutput options, e.g. logger.OutputQueueSize
+
+	// SkipRepeating merges repeated messages, see logger.OutputDedup; also set by the "skipRepeating" config field
+	SkipRepeating bool
+}
+
+// LogOutputFactory creates a log output from its section of the "outputs" logger config. lgr is the global logger,
+// e.g. to log what is being set up.
+type LogOutputFactory func(cfg IConfig, lgr logger.Logger) (*LogOutput, error)
+
+var logOutputFactories = map[string]LogOutputFactory{}
+var logOutputFactoriesMux sync.RWMutex
+
+// RegisterLogOutput registers a log output type under one or more names (case-insensitive), so that it can be used
+// in the "outputs" section of the logger config. It must be called before GetOrCreateGlobalContext, typically from an
+// init function. Registering an existing name replaces it.
+func RegisterLogOutput(factory LogOutputFactory, names ...string) {
+	logOutputFactoriesMux.Lock()
+	defer logOutputFactoriesMux.Unlock()
+	for _, name := range names {
+		logOutputFactories[strings.ToLower(name)] = factory
+	}
+}
+
+// getLogOutputFactory returns the factory registered under name, or nil
+func getLogOutputFactory(name string) LogOutputFactory {
+	logOutputFactoriesMux.RLock()
+	defer logOutputFactoriesMux.RUnlock()
+	return logOutputFactories[strings.ToLower(name)]
+}
+
+// addLogOutput creates the output outputType with its config section and adds it to lgr
+func addLogOutput(lgr logger.Logger, outputType string, cfg IConfig) {
+	factory := getLogOutputFactory(outputType)
+	if factory == nil {
+		panic("unknown log output type: " + outputType)
+	}
+	output, err := factory(cfg, lgr)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create %s log output: %v", outputType, err))
+	}
+
+	opts := []interface{}{logger.OutputName(outputType), sourceInfoFromConfig(cfg)}
+	if output.Formatter != nil {
+		opts = append(opts, output.Formatter)
+	}
+	if output.SkipRepeating || cfg.GetBoolDefault("skipRepeating", false) {
+		// "repeatInterval" is the maximum delay in seconds of the repeat summary
+		interval := cfg.GetFloatDefault("repeatInterval", logger.LogDedupInterval.Seconds())
+		opts = append(opts, logger.OutputDedup(time.Duration(interval*float64(time.Second))))
+	}
+	opts = append(opts, output.Options...)
+	handle := lgr.AddOutput(output.Filter, output.Writer, output.Level, output.Ansi, output.TrailCR, opts...)
+	namespaceLevelsFromConfig(cfg, handle)
+}
+
+func init() {
+	RegisterLogOutput(natsLogOutput, "nats_publisher", "natspublisher", "nats")
+	RegisterLogOutput(fileLogOutput, "filewriter", "file")
+	RegisterLogOutput(jsonStreamLogOutput, "jsonstream", "jsonout", "prod")
+	RegisterLogOutput(syslogLogOutput, "syslog")
+	RegisterLogOutput(windowLogOutput, "window", "gui")
+}
+
+// natsLogOutput publishes logs to a NATS subject, and optionally serves remote log control commands (see
+// logger.LogControl) on "controlSubject". Logs are buffered while NATS is unavailable, see
+// logger.DurableNatsPublisher; the process starts even if NATS can't be reached.
+func natsLogOutput(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+	subject := cfg.GetStringDefault("subject", "default-logger-subject")
+	url := cfg.GetStringDefault("url", nats.DefaultURL)
+	rawLevel := cfg.GetStringDefault("logLevel", "debug")
+	ansi := cfg.GetBoolDefault("ansicodes", false)
+
+	if len(*subject) == 0 {
+		return nil, fmt.Errorf("empty publishing subject")
+	}
+
+	var nkeyOpt nats.Option
+	nSeedFile := *cfg.GetStringDefault("natsSeed", "")
+	if len(nSeedFile) > 0 {
+		var err error
+		nkeyOpt, err = nats.NkeyOptionFromSeed(nSeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get NATS seed from %s: %v", nSeedFile, err)
+		}
+	}
+
+	publisherOpts := logger.NatsPublisherOptions{
+		BufferSize:   int(cfg.GetIntDefault("bufferSize", 0)),
+		SpillDir:     *cfg.GetStringDefault("spillDir", ""),
+		MaxSpillSize: cfg.GetIntDefault("maxSpillMB", 0) * 1024 * 1024,
+		JetStream:    cfg.GetBoolDefault("jetstream", false),
+		Stream:       *cfg.GetStringDefault("stream", ""),
+		AckTimeout:   time.Duration(cfg.GetIntDefault("ackTimeout", 0)) * time.Second,
+	}
+	publisher, err := logger.NewDurableNatsPublisher(*url, *subject, publisherOpts, nkeyOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	// optional remote log control, see logger.LogControl
+	if controlSubject := cfg.GetString("controlSubject"); controlSubject != nil && *controlSubject != "" {
+		asyncLogger, ok := lgr.(*logger.AsyncLogger)
+		if !ok {
+			return nil, fmt.Errorf("logger does not support remote control")
+		}
+		if _, err := logger.NewLogControl(asyncLogger, publisher.Conn(), *controlSubject); err != nil {
+			return nil, err
+		}
+		lgr.Infof("*", "Listening for log control commands on %s", *controlSubject)
+	}
+
+	if !publisher.Conn().IsConnected() {
+		lgr.Warnf("*", "NATS %s is not available yet, buffering logs for %s", *url, *subject)
+	}
+	return &LogOutput{
+		Writer:    publisher,
+		Formatter: formatterFromConfig(cfg, "simple", ansi, false),
+		Filter:    filterFromConfig(cfg, logger.FilterMatchAll),
+		Level:     logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		Ansi:      ansi,
+	}, nil
+}
+
+// fileLogOutput writes logs to daily files, see logger.FileWriter
+func fileLogOutput(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+	rawLevel, path, prefix, suffix, skipRepeating :=
+		cfg.GetStringDefault("logLevel", "debug"),
+		cfg.GetStringDefault("path", "/tmp/test_logs"),
+		cfg.GetStringDefault("filePrefix", ""),
+		cfg.GetStringDefault("fileSuffix", ".log"),
+		cfg.GetBoolDefault("skipRepeating", true)
+
+	fileOpts := logger.FileWriterOptions{
+		MaxSize:  cfg.GetIntDefault("maxSizeMB", 0) * 1024 * 1024,
+		MaxFiles: int(cfg.GetIntDefault("maxFiles", 0)),
+		MaxAge:   time.Duration(cfg.GetIntDefault("maxAgeDays", 0)) * 24 * time.Hour,
+		Compress: cfg.GetBoolDefault("compress", false),
+	}
+	// "signingKey" is a PEM file of the ed25519 key signing the checkpoints of the hash-chained lines, see
+	// logger.VerifySignedLog; "checkpointInterval" is in seconds
+	if keyFile := cfg.GetStringDefault("signingKey", ""); *keyFile != "" {
+		key, err := ReadPemPrivateKey(*keyFile)
+		if err != nil {
+			return nil, err
+		}
+		fileOpts.SigningKey = key
+		fileOpts.CheckpointLines = int(cfg.GetIntDefault("checkpointLines", int64(logger.LogCheckpointLines)))
+		fileOpts.CheckpointInterval = time.Duration(cfg.GetFloatDefault("checkpointInterval",
+			logger.LogCheckpointInterval.Seconds()) * float64(time.Second))
+	}
+
+	// repeated messages are merged before formatting, see LogOutput.SkipRepeating
+	fileWriter, err := logger.NewFileWriterEx(*path, prefix, suffix, false, fileOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	lgr.Infof("*", "Adding log file output; filter=%s exclude=%s path=%s level=%s maxSize=%d maxFiles=%d maxAge=%v compress=%v signed=%v",
+		*cfg.GetStringDefault("filter", ""), *cfg.GetStringDefault("exclude", ""), *path, *rawLevel,
+		fileOpts.MaxSize, fileOpts.MaxFiles, fileOpts.MaxAge, fileOpts.Compress, fileOpts.SigningKey != nil)
+	return &LogOutput{
+		Writer:    fileWriter,
+		Formatter: formatterFromConfig(cfg, "simple", false, true),
+		Filter:    filterFromConfig(cfg, logger.FilterMatchAll),
+		Level:     logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		TrailCR:   true,
+
+		SkipRepeating: skipRepeating,
+	}, nil
+}
+
+// windowLogOutput writes logs to the gocui log window, or to stdout without gui, see LogWindow. The default stdout
+// output should be disabled (e.g. filter = "^$") so that messages are not written twice without gui.
+func windowLogOutput(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+	rawLevel := cfg.GetStringDefault("logLevel", "debug")
+	window := NewLogWindow(LogWindowOptions{
+		View:       *cfg.GetStringDefault("view", ""),
+		Scrollback: int(cfg.GetIntDefault("scrollback", 0)),
+	})
+
+	lgr.Infof("*", "Adding log window output; filter=%s exclude=%s level=%s gui=%v", *cfg.GetStringDefault("filter", ""),
+		*cfg.GetStringDefault("exclude", ""), *rawLevel, UseGuiQ())
+	return &LogOutput{
+		Writer:    window,
+		Formatter: formatterFromConfig(cfg, "simple", true, true),
+		Filter:    filterFromConfig(cfg, logger.FilterMatchAll),
+		Level:     logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		Ansi:      true,
+		TrailCR:   true,
+	}, nil
+}
+
+// jsonStreamLogOutput writes JSON logs to stderr
+func jsonStreamLogOutput(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+	rawLevel := cfg.GetStringDefault("logLevel", "info")
+
+	lgr.Infof("*", "Adding log json output; filter=%s exclude=%s level=%s", *cfg.GetStringDefault("filter", ""), *cfg.GetStringDefault("exclude", ""), *rawLevel)
+	return &LogOutput{
+		Writer:    os.Stderr,
+		Formatter: formatterFromConfig(cfg, "json", false, true),
+		Filter:    filterFromConfig(cfg, logger.FilterMatchAll),
+		Level:     logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+		TrailCR:   true,
+	}, nil
+}
+
+// syslogLogOutput sends logs to a syslog server or relay, see logger.SyslogWriter. The "format" is rfc5424 (default)
+// or rfc3164; an empty address with the unix network uses the local syslog socket.
+func syslogLogOutput(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+	rawLevel, network, address :=
+		cfg.GetStringDefault("logLevel", "debug"),
+		cfg.GetStringDefault("network", "udp"),
+		cfg.GetStringDefault("address", "localhost:514")
+
+	writer, err := logger.NewSyslogWriter(*network, *address, logger.SyslogWriterOptions{
+		BufferSize:        int(cfg.GetIntDefault("bufferSize", 0)),
+		ReconnectInterval: time.Duration(cfg.GetIntDefault("reconnectInterval", 0)) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lgr.Infof("*", "Adding syslog output; filter=%s exclude=%s network=%s address=%s level=%s",
+		*cfg.GetStringDefault("filter", ""), *cfg.GetStringDefault("exclude", ""), *network, *address, *rawLevel)
+	return &LogOutput{
+		Writer:    writer,
+		Formatter: formatterFromConfig(cfg, "rfc5424", false, false),
+		Filter:    filterFromConfig(cfg, logger.FilterMatchAll),
+		Level:     logger.ParseLogLevel(*rawLevel, logger.LogLevelDebug),
+	}, nil
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+)
+
+func TestRegisterLogOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"outputs": {"Memory": {"logLevel": "warn", "levels": "noisy=error"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := (&Vconfig{}).ReadConfig(filename).FromKey("outputs").FromKey("Memory")
+
+	var buf bytes.Buffer
+	RegisterLogOutput(func(cfg IConfig, lgr logger.Logger) (*LogOutput, error) {
+		return &LogOutput{
+			Writer:  &buf,
+			Filter:  logger.FilterMatchAll,
+			Level:   logger.ParseLogLevel(*cfg.GetStringDefault("logLevel", "debug"), logger.LogLevelDebug),
+			TrailCR: true,
+		}, nil
+	}, "memory", "mem")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lgr := logger.NewAsyncLogger(ctx, logger.LogLevelFatal, logger.FilterMatchNone)
+	addLogOutput(lgr, "Memory", cfg)
+
+	lgr.Infof("test", "not written")
+	lgr.Warnf("test", "written")
+	lgr.Warnf("noisy", "not written either")
+	lgr.Flush()
+
+	if got := buf.String(); !strings.Contains(got, "written") || strings.Contains(got, "not written") {
+		t.Errorf("unexpected output %q", got)
+	}
+	if lgr.Output("Memory") == nil {
+		t.Errorf("output not named after its type")
+	}
+	if getLogOutputFactory("MEM") == nil || getLogOutputFactory("nats") == nil {
+		t.Errorf("log output types not registered")
+	}
+}
@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/andrewelkin/trilib/utils/logger"
+	"github.com/jroimartin/gocui"
+)
+
+// LogWindowScrollback is the default number of messages kept by a LogWindow
+var LogWindowScrollback = 5000
+
+// LogWindowCommand starts the commands typed into the "stdin" view that change what the log window shows, see
+// LogWindow.Command; they are not passed to the command handler of InitKeybindings
+var LogWindowCommand = "/log"
+
+// ansiEscapeRegexp matches the ansi escape codes written by the formatters
+var ansiEscapeRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// LogWindowOptions configures a LogWindow
+type LogWindowOptions struct {
+	View       string    // name of the gocui view; LogWin if ""
+	Scrollback int       // number of messages kept; LogWindowScrollback if 0
+	Fallback   io.Writer // written when UseGuiQ() is false; os.Stdout if nil
+}
+
+// LogWindow is an io.Writer for a log output, writing the messages to a gocui view through GlobalGui.Update, or to
+// stdout when UseGuiQ() is false. The output should use a formatter with ansi support: gocui renders the colors, and
+// they are stripped when stdout is not a terminal.
+//
+// The window keeps the last messages, and shows those matching its level and namespace filter; changing them with a
+// "/log" command typed into the "stdin" view (see Command) applies to the messages already shown too.
+type LogWindow struct {
+	opts LogWindowOptions
+
+	mux      sync.Mutex
+	entries  []windowEntry
+	minLevel logger.LogLevel
+	filter   logger.FilterFunc
+	status   windowStatus
+
+	pending   strings.Builder // shown messages not written to the view yet
+	viewCount int             // messages written to the view since it was last redrawn
+	redraw    bool            // the view must be rebuilt from the entries
+	updating  bool            // a GlobalGui.Update is scheduled
+}
+
+// windowStatus is the level and filters of a LogWindow as set by the user, see Command
+type windowStatus struct {
+	level, filter, exclude string
+}
+
+type windowEntry struct {
+	level     logger.LogLevel
+	namespace string
+	text      string
+}
+
+var activeLogWindow *LogWindow
+var activeLogWindowMux sync.Mutex
+
+// NewLogWindow creates a LogWindow; the last one created receives the "/log" commands of InitKeybindings
+func NewLogWindow(opts LogWindowOptions) *LogWindow {
+	if opts.Scrollback <= 0 {
+		opts.Scrollback = LogWindowScrollback
+	}
+	if opts.Fallback == nil {
+		opts.Fallback = os.Stdout
+	}
+	lw := &LogWindow{opts: opts, minLevel: logger.LogLevelDebug, filter: logger.FilterMatchAll, status: windowStatus{level: "debug"}}
+
+	activeLogWindowMux.Lock()
+	activeLogWindow = lw
+	activeLogWindowMux.Unlock()
+	return lw
+}
+
+// Write implements io.Writer; p is a formatted message
+func (lw *LogWindow) Write(p []byte) (int, error) {
+	if !UseGuiQ() {
+		txt := string(p)
+		if !isTerminal(lw.opts.Fallback) {
+			txt = ansiEscapeRegexp.ReplaceAllString(txt, "")
+		}
+		if _, err := io.WriteString(lw.opts.Fallback, txt); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if lw.add(string(p)) {
+		GlobalGui.Update(lw.render)
+	}
+	return len(p), nil
+}
+
+// add keeps a message, and queues it for the view if it is shown; returns true if an update must be scheduled
+func (lw *LogWindow) add(txt string) bool {
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+
+	e := windowEntry{text: txt, level: logger.LogLevelInfo}
+	if rec, err := logger.ParseLogLine(ansiEscapeRegexp.ReplaceAllString(txt, "")); err == nil {
+		e.level, e.namespace = rec.Level, rec.Namespace
+	} else if n := len(lw.entries); n > 0 {
+		// e.g. a line without date, see NoDateNextLine
+		e.level, e.namespace = lw.entries[n-1].level, lw.entries[n-1].namespace
+	}
+	// up to twice the scrollback is kept, so that trimming is not done on each message
+	if len(lw.entries) >= 2*lw.opts.Scrollback {
+		lw.entries = append(lw.entries[:0], lw.entries[len(lw.entries)-lw.opts.Scrollback+1:]...)
+	}
+	lw.entries = append(lw.entries, e)
+
+	// while a redraw is due, the view is rebuilt from the entries instead
+	if lw.shows(e) && !lw.redraw {
+		lw.pending.WriteString(txt)
+		lw.viewCount++
+		// the view is trimmed to the scrollback once it holds twice as many messages
+		if lw.viewCount > 2*lw.opts.Scrollback {
+			lw.redraw = true
+		}
+	}
+	return lw.schedule()
+}
+
+func (lw *LogWindow) shows(e windowEntry) bool {
+	return e.level >= lw.minLevel && lw.filter(e.namespace)
+}
+
+// schedule returns true if an update must be scheduled, i.e. there is something to render and none is scheduled yet
+func (lw *LogWindow) schedule() bool {
+	if lw.updating || (lw.pending.Len() == 0 && !lw.redraw) {
+		return false
+	}
+	lw.updating = true
+	return true
+}
+
+// render writes the pending messages to the view, in the gui goroutine
+func (lw *LogWindow) render(g *gocui.Gui) error {
+	v := LogWin
+	if lw.opts.View != "" {
+		v, _ = g.View(lw.opts.View)
+	}
+
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+	lw.updating = false
+	if v == nil {
+		// not laid out yet, or a wrong view name: the view is rebuilt from the entries once it exists, rather than
+		// keeping the pending messages without bound
+		lw.pending.Reset()
+		lw.redraw = true
+		return nil
+	}
+	if lw.redraw {
+		v.Clear()
+		lw.pending.Reset()
+		lw.pending.WriteString(lw.shownText())
+		lw.redraw = false
+	}
+	io.WriteString(v, lw.pending.String())
+	lw.pending.Reset()
+	return nil
+}
+
+// shownText returns the messages kept that are shown, and counts them as written to the view
+func (lw *LogWindow) shownText() string {
+	var sb strings.Builder
+	lw.viewCount = 0
+	kept := lw.entries
+	if len(kept) > lw.opts.Scrollback {
+		kept = kept[len(kept)-lw.opts.Scrollback:]
+	}
+	for _, e := range kept {
+		if lw.shows(e) {
+			sb.WriteString(e.text)
+			lw.viewCount++
+		}
+	}
+	return sb.String()
+}
+
+// SetLevel shows the messages at level and above
+func (lw *LogWindow) SetLevel(level logger.LogLevel) {
+	lw.mux.Lock()
+	lw.minLevel = level
+	lw.refilter()
+}
+
+// SetFilter shows the messages with a namespace matching filter and not matching exclude, substrings or regular
+// expressions; "" matches all namespaces, or excludes none
+func (lw *LogWindow) SetFilter(filter, exclude string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid filter: %v", r)
+		}
+	}()
+	f := logger.FilterMatchAll
+	if filter != "" {
+		f = logger.Filter(filter)
+	}
+	if exclude != "" {
+		f = logger.And(f, logger.Not(exclude))
+	}
+
+	lw.mux.Lock()
+	lw.filter = f
+	lw.status.filter, lw.status.exclude = filter, exclude
+	lw.refilter()
+	return nil
+}
+
+// refilter redraws the view with the current filters; called with lw.mux held, which it releases
+func (lw *LogWindow) refilter() {
+	lw.redraw = true
+	update := UseGuiQ() && lw.schedule()
+	lw.mux.Unlock()
+	if update {
+		GlobalGui.Update(lw.render)
+	}
+}
+
+// Command applies a command typed into the "stdin" view, returning false if it is not a LogWindowCommand:
+//
+//	/log                   shows the current level and filters
+//	/log level warn        shows WARN messages and above
+//	/log filter ^exch      shows the namespaces matching a substring or a regular expression; none to clear
+//	/log exclude ^_        hides the namespaces matching a substring or a regular expression; none to clear
+//	/log all               shows all the messages kept
+func (lw *LogWindow) Command(cmd string) bool {
+	args := strings.Fields(cmd)
+	if len(args) == 0 || args[0] != LogWindowCommand {
+		return false
+	}
+	arg := ""
+	if len(args) == 3 {
+		arg = args[2]
+	}
+
+	lw.mux.Lock()
+	status := lw.status
+	lw.mux.Unlock()
+	var err error
+	switch {
+	case len(args) == 1:
+	case args[1] == "level" && len(args) == 3:
+		level := logger.ParseLogLevel(arg, logger.LogLevelFatal+1)
+		if level > logger.LogLevelFatal {
+			err = fmt.Errorf("unknown level %q", arg)
+			break
+		}
+		lw.mux.Lock()
+		lw.status.level = strings.ToLower(arg)
+		lw.mux.Unlock()
+		lw.SetLevel(level)
+	case args[1] == "filter" && len(args) <= 3:
+		err = lw.SetFilter(arg, status.exclude)
+	case args[1] == "exclude" && len(args) <= 3:
+		err = lw.SetFilter(status.filter, arg)
+	case args[1] == "all" && len(args) == 2:
+		lw.mux.Lock()
+		lw.status.level = "debug"
+		lw.mux.Unlock()
+		lw.SetLevel(logger.LogLevelDebug)
+		err = lw.SetFilter("", "")
+	default:
+		err = fmt.Errorf("usage: %s [level <level> | filter [namespaces] | exclude [namespaces] | all]", LogWindowCommand)
+	}
+
+	lw.mux.Lock()
+	status = lw.status
+	lw.mux.Unlock()
+	reply := fmt.Sprintf("log window: level=%s filter=%q exclude=%q", status.level, status.filter, status.exclude)
+	if err != nil {
+		reply = "log window: " + err.Error()
+	}
+	if UseGuiQ() && LogWin != nil {
+		GlobalGui.Update(func(g *gocui.Gui) error {
+			fmt.Fprintln(LogWin, reply)
+			return nil
+		})
+	} else {
+		fmt.Fprintln(lw.opts.Fallback, reply)
+	}
+	return true
+}
+
+// handleLogWindowCommand passes cmd to the active LogWindow, if any; returns true if it was a LogWindowCommand
+func handleLogWindowCommand(cmd string) bool {
+	activeLogWindowMux.Lock()
+	lw := activeLogWindow
+	activeLogWindowMux.Unlock()
+	return lw != nil && lw.Command(cmd)
+}
+
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jroimartin/gocui"
+)
+
+func TestLogWindowFallback(t *testing.T) {
+	var buf bytes.Buffer
+	lw := NewLogWindow(LogWindowOptions{Fallback: &buf})
+	if _, err := lw.Write([]byte("2021-02-03 09:47:58.901 (app) [\x1b[31mERROR\x1b[0m]: failed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "2021-02-03 09:47:58.901 (app) [ERROR]: failed\n" {
+		t.Errorf("unexpected fallback output %q", got)
+	}
+}
+
+func TestLogWindowFilters(t *testing.T) {
+	var buf bytes.Buffer
+	lw := NewLogWindow(LogWindowOptions{Fallback: &buf, Scrollback: 3})
+	lines := []string{
+		"2021-02-03 09:47:58.901 (app) [INFO]: dropped from the scrollback\n",
+		"2021-02-03 09:47:58.902 (WS) [DEBUG]: ping\n",
+		"2021-02-03 09:47:58.903 (app) [WARN]: slow\n",
+		"continuation of the warning\n",
+	}
+	for _, line := range lines {
+		if !lw.add(line) && line == lines[0] {
+			t.Errorf("update not scheduled")
+		}
+	}
+	if got := lw.pending.String(); got != strings.Join(lines, "") {
+		t.Errorf("unexpected pending text %q", got)
+	}
+
+	if !lw.Command("/log level warn") || !lw.redraw {
+		t.Fatalf("level command not applied")
+	}
+	if got := lw.shownText(); got != lines[2]+lines[3] {
+		t.Errorf("unexpected text at WARN %q", got)
+	}
+	lw.Command("/log all")
+	lw.Command("/log exclude ^app$")
+	if got := lw.shownText(); got != lines[1] {
+		t.Errorf("unexpected text without app %q", got)
+	}
+	if lw.Command("/logs") || lw.Command("buy 1 BTC") {
+		t.Errorf("not a log window command")
+	}
+	lw.Command("/log level verbose")
+	lw.Command("/log")
+
+	replies := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(replies) != 5 {
+		t.Fatalf("unexpected replies %q", replies)
+	}
+	if replies[3] != `log window: unknown level "verbose"` {
+		t.Errorf("unexpected error reply %q", replies[3])
+	}
+	if replies[4] != `log window: level=debug filter="" exclude="^app$"` {
+		t.Errorf("unexpected status reply %q", replies[4])
+	}
+}
+
+func TestLogWindowWithoutView(t *testing.T) {
+	lw := NewLogWindow(LogWindowOptions{View: "missing", Scrollback: 2})
+	line := "2021-02-03 09:47:58.901 (app) [INFO]: started\n"
+	lw.add(line)
+	if err := lw.render(&gocui.Gui{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		lw.add(line)
+	}
+	// nothing is kept for the view while it does not exist, it is rebuilt from the scrollback once it does
+	if lw.pending.Len() != 0 || !lw.redraw {
+		t.Errorf("pending text kept without a view: %d bytes", lw.pending.Len())
+	}
+	if len(lw.entries) > 2*lw.opts.Scrollback {
+		t.Errorf("unexpected number of entries %d", len(lw.entries))
+	}
+	if got := lw.shownText(); got != line+line {
+		t.Errorf("unexpected text %q", got)
+	}
+}
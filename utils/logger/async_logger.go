@@ -3,11 +3,14 @@ package logger
 import (
 	"context"
 	"fmt"
+	"github.com/andrewelkin/trilib/utils/metrics"
 	"github.com/mgutz/ansi"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // LogDefaultFilter is the regular expression that is used in new loggers as the filter applied to the default
@@ -15,11 +18,13 @@ import (
 var LogDefaultFilter = FilterUnderscore
 
 // LogBufferSize is the size of the pending log buffer (number of logs in the write queue that can be present until log
-// requests start blocking in the calling go-routine).
+// requests start blocking in the calling go-routine, or being dropped; see SetBackpressurePolicy).
 var LogBufferSize = 256
 
 // LogCacheSize is the size of the log cache: logs that are maintained before/after writing until they are dumped to a
 // file (or other output) at the request of the user. Sets the number of recent logs retained (FIFO order).
+// The cache holds every message regardless of output levels and filters, and is dumped automatically on Fatalf or a
+// panic caught by DumpOnPanic; see DumpCache. Set to 0 before creating the logger to disable it.
 var LogCacheSize = 1000
 
 var defaultScreenDst io.Writer = os.Stdout
@@ -33,14 +38,48 @@ var DefaultScreenOutputFunc = func(dst io.Writer, txt string) {
 
 // AsyncLogger implements Logger and handles logs from writing go-routines in an asynchronous manner.
 type AsyncLogger struct {
+	// dropped message counters, by level; first in the struct for 64-bit alignment of atomic operations
+	dropped      [LogLevelFatal + 1]uint64
+	droppedTotal uint64
+
 	mux       sync.RWMutex
 	wg        sync.WaitGroup
 	blockLogs bool
 
-	logs    chan logMessage
-	outputs []logOutput
+	logs              chan logMessage
+	held              []logMessage // taken out of logs by BackpressureDropOldest, ahead of it; see receiveLogs
+	evictMux          sync.RWMutex // read-locked by the writer goroutine while receiving, write-locked while evicting
+	outputs           []*logOutput // replaced, never modified in place; see addOutput
+	outputsMux        sync.RWMutex
+	outputSeq         int
+	writeErrorHandler WriteErrorHandler
 
 	formatter Formatter
+
+	cache          *logCache // recent messages, regardless of output levels; see LogCacheSize
+	cacheFormatter Formatter
+	cacheMux       sync.Mutex
+	cacheDumpFile  string
+
+	backpressure uint32 // BackpressurePolicy, see SetBackpressurePolicy
+	dropLevel    uint32 // LogLevel below which BackpressureDropBelowLevel drops messages
+	metrics      metrics.Metrics
+	metricsMux   sync.Mutex
+
+	errorPolicy  uint32 // ErrorPolicy, see SetErrorPolicy
+	errorHook    ErrorHook
+	fatalHandler FatalHandler
+	fatalTimeout time.Duration
+	fatalOnce    sync.Once
+	testMode     bool
+	failures     []Failure
+	failureMux   sync.Mutex
+
+	redactor redactor // see SetRedactPatterns
+	sampler  sampler  // see SetSampling
+
+	namespaces    atomic.Value // *namespaceSettings, see SetNamespaceLevels
+	namespacesMux sync.Mutex
 }
 
 func SetDefaultScreenIO(dst io.Writer) {
@@ -58,121 +97,250 @@ func SetDefaultScreenIOfunc(f func(io.Writer, string)) {
 // stdout filter is specified, the regular expression defined by LogDefaultFilter is used.
 func NewAsyncLogger(ctx context.Context, level LogLevel, stdoutFilter FilterFunc) *AsyncLogger {
 	logger := &AsyncLogger{
-		logs: make(chan logMessage, LogBufferSize),
+		logs:           make(chan logMessage, LogBufferSize),
+		cache:          newLogCache(LogCacheSize),
+		cacheFormatter: NewSimpleFormatter(false, true),
+		redactor:       redactor{fieldNames: LogRedactFieldNames},
 		// ansiBlack: ansi.ColorCode("black"),
 	}
 
 	if stdoutFilter == nil {
 		stdoutFilter = FilterMatchAll
 	}
-	logger.outputs = append(logger.outputs, logOutput{
-		filter: stdoutFilter, dst: defaultScreenDst, minLevel: level, formatter: NewSimpleFormatter(true, true),
+	logger.addOutput(&logOutput{
+		name: DefaultOutputName, filter: stdoutFilter, dst: defaultScreenDst, minLevel: level, formatter: NewSimpleFormatter(true, true),
 	})
 
 	go logger.handleLogs(ctx)
+	go logger.reportDropped(ctx)
+	go logger.reportSampled(ctx)
 	return logger
 }
 
 // Debugf implements Logger
 func (lgr *AsyncLogger) Debugf(namespace, format string, a ...interface{}) {
-	lgr.withLogsNotBlocked(func() {
-		lgr.logs <- newLogMessage(LogLevelDebug, namespace, format, a...)
-	})
+	lgr.log(newLogMessage(LogLevelDebug, namespace, format, a...))
 }
 
 // Infof implements Logger
 func (lgr *AsyncLogger) Infof(namespace, format string, a ...interface{}) {
-	lgr.withLogsNotBlocked(func() {
-		lgr.logs <- newLogMessage(LogLevelInfo, namespace, format, a...)
-	})
+	lgr.log(newLogMessage(LogLevelInfo, namespace, format, a...))
 }
 
 // Warnf implements Logger
 func (lgr *AsyncLogger) Warnf(namespace, format string, a ...interface{}) {
-	lgr.withLogsNotBlocked(func() {
-		lgr.logs <- newLogMessage(LogLevelWarn, namespace, format, a...)
-	})
+	lgr.log(newLogMessage(LogLevelWarn, namespace, format, a...))
 }
 
 // Errorf implements Logger
-// Will trigger panic in the calling goroutine
+// Will trigger panic in the calling goroutine, unless another policy is set with SetErrorPolicy
 func (lgr *AsyncLogger) Errorf(namespace, format string, a ...interface{}) {
 	message := fmt.Sprintf(format, a...)
-	lgr.withLogsNotBlocked(func() {
-		lgr.logs <- newLogMessage(LogLevelError, namespace, message)
-	})
-	panic(message)
+	lgr.log(newLogMessageW(LogLevelError, namespace, message, nil))
+	lgr.onError(namespace, message)
 }
 
 // Fatalf implements Logger
-// Will trigger immediate process termination from the log writer goroutine
+// Will trigger process termination from the log writer goroutine, after the fatal handler if any (see SetFatalHandler)
 func (lgr *AsyncLogger) Fatalf(namespace, format string, a ...interface{}) {
-	lgr.withLogsNotBlocked(func() {
-		lgr.logs <- newLogMessage(LogLevelFatal, namespace, format, a...)
-	})
+	lgr.log(newLogMessage(LogLevelFatal, namespace, format, a...))
+}
+
+// Debugw implements Logger
+func (lgr *AsyncLogger) Debugw(namespace, msg string, keysAndValues ...interface{}) {
+	lgr.log(newLogMessageW(LogLevelDebug, namespace, msg, fieldsFromArgs(keysAndValues)))
+}
+
+// Infow implements Logger
+func (lgr *AsyncLogger) Infow(namespace, msg string, keysAndValues ...interface{}) {
+	lgr.log(newLogMessageW(LogLevelInfo, namespace, msg, fieldsFromArgs(keysAndValues)))
+}
+
+// Warnw implements Logger
+func (lgr *AsyncLogger) Warnw(namespace, msg string, keysAndValues ...interface{}) {
+	lgr.log(newLogMessageW(LogLevelWarn, namespace, msg, fieldsFromArgs(keysAndValues)))
+}
+
+// Errorw implements Logger
+// Will trigger panic in the calling goroutine, unless another policy is set with SetErrorPolicy
+func (lgr *AsyncLogger) Errorw(namespace, msg string, keysAndValues ...interface{}) {
+	lgr.log(newLogMessageW(LogLevelError, namespace, msg, fieldsFromArgs(keysAndValues)))
+	lgr.onError(namespace, msg)
+}
+
+// Fatalw implements Logger
+// Will trigger process termination from the log writer goroutine, after the fatal handler if any (see SetFatalHandler)
+func (lgr *AsyncLogger) Fatalw(namespace, msg string, keysAndValues ...interface{}) {
+	lgr.log(newLogMessageW(LogLevelFatal, namespace, msg, fieldsFromArgs(keysAndValues)))
+}
+
+// With implements Logger
+func (lgr *AsyncLogger) With(keysAndValues ...interface{}) Logger {
+	return &childLogger{parent: lgr, fields: fieldsFromArgs(keysAndValues)}
 }
 
 // AddOutput implements Logger
-func (lgr *AsyncLogger) AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, options ...interface{}) {
+// Options: a Formatter replaces the default SimpleFormatter, an OutputName names the output, an OutputQueueSize sets
+// the size of the output queue (LogOutputQueueSize by default), a SourceInfo adds the caller and the stack to the
+// messages, an OutputDedup merges repeated messages.
+func (lgr *AsyncLogger) AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, options ...interface{}) OutputHandle {
 	var fmt Formatter
+	var name OutputName
+	queueSize := LogOutputQueueSize
+	sourceInfo := SourceNone
+	var dedup OutputDedup
 	for _, opt := range options {
-		if fmtOpt, ok := opt.(Formatter); ok {
-			fmt = fmtOpt
+		switch opt := opt.(type) {
+		case Formatter:
+			fmt = opt
+		case OutputName:
+			name = opt
+		case OutputQueueSize:
+			queueSize = int(opt)
+		case SourceInfo:
+			sourceInfo = opt
+		case OutputDedup:
+			dedup = opt
+			if dedup <= 0 {
+				dedup = OutputDedup(LogDedupInterval)
+			}
 		}
 	}
 	if fmt == nil {
 		fmt = NewSimpleFormatter(ansi, trailCR)
 	}
-	lgr.outputs = append(lgr.outputs, logOutput{filter: filter, minLevel: minLevel, dst: output, formatter: fmt})
+	if filter == nil {
+		filter = FilterMatchAll
+	}
+	out := &logOutput{name: string(name), filter: filter, minLevel: minLevel, dst: output, formatter: fmt, queueSize: queueSize,
+		sourceInfo: uint32(sourceInfo), dedup: dedup}
+	lgr.addOutput(out)
+	return out
 }
 
 // NewLine inserts \n before next output
 func (lgr *AsyncLogger) NewLine() {
-	for _, outputConfig := range lgr.outputs {
+	for _, outputConfig := range lgr.getOutputs() {
 		outputConfig.formatter.NewLine()
 	}
 }
 
 // NoDateNextLine starts next line without date/debug/servie label
 func (lgr *AsyncLogger) NoDateNextLine() {
-	for _, outputConfig := range lgr.outputs {
+	for _, outputConfig := range lgr.getOutputs() {
 		outputConfig.formatter.NoDateNextLine()
 	}
 }
 
 // Flush implements Logger
+// Waits until the messages logged so far have been written to every output. Calling it from the writer goroutine or
+// from an output writer, e.g. from an io.Writer that logs its errors with ErrorPolicyHook and a hook flushing the
+// logger, deadlocks: the flush waits for the goroutine it blocks.
 func (lgr *AsyncLogger) Flush() {
+	flushed := make(chan struct{})
+	var queued bool
+	lgr.withLogsNotBlocked(func() {
+		lgr.logs <- logMessage{flushed: flushed}
+		queued = true
+	})
+	if queued {
+		<-flushed
+	}
+}
+
+// drainPending dispatches the messages pending in the queue, then waits for the outputs to write them.
+// Must be called from the writer goroutine.
+func (lgr *AsyncLogger) drainPending() {
 	for {
-		select {
-		case log := <-lgr.logs:
+		logs := lgr.receiveLogs(nil)
+		if len(logs) == 0 {
+			lgr.flushOutputs()
+			return
+		}
+		for _, log := range logs {
 			lgr.writeLogAccordingToLevel(log)
+		}
+	}
+}
+
+// drainQueued dispatches the messages pending in the queue when it is called, not those logged since, then waits
+// until deadline at most for the outputs to write them. Must be called from the writer goroutine.
+func (lgr *AsyncLogger) drainQueued(deadline time.Time) {
+	for n := len(lgr.logs); n > 0; n-- {
+		logs := lgr.receiveLogs(nil)
+		if len(logs) == 0 {
 			break
+		}
+		for _, log := range logs {
+			lgr.writeLogAccordingToLevel(log)
+		}
+	}
+	if !lgr.flushOutputsUntil(deadline) {
+		fmt.Fprintf(os.Stderr, "log outputs not flushed within %v\n", LogFatalFlushTimeout)
+	}
+}
+
+// receiveLogs returns the next pending message, preceded by the messages held by BackpressureDropOldest, which were
+// queued before it. It waits for a message until done is closed, or returns at once if done is nil.
+// Must be called from the writer goroutine.
+func (lgr *AsyncLogger) receiveLogs(done <-chan struct{}) []logMessage {
+	// evicting takes the write lock, so that no message is held once the next one has been received
+	lgr.evictMux.RLock()
+	defer lgr.evictMux.RUnlock()
+
+	var received []logMessage
+	if done == nil {
+		select {
+		case log := <-lgr.logs:
+			received = append(received, log)
 		default:
-			return
+		}
+	} else {
+		select {
+		case log := <-lgr.logs:
+			received = append(received, log)
+		case <-done:
 		}
 	}
+	held := lgr.held
+	lgr.held = nil
+	return append(held, received...)
 }
 
 func (lgr *AsyncLogger) handleLogs(ctx context.Context) {
 	for {
-		select {
-		case log := <-lgr.logs:
+		for _, log := range lgr.receiveLogs(ctx.Done()) {
 			lgr.writeLogAccordingToLevel(log)
-		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
 			func() {
 				lgr.mux.Lock()
 				defer lgr.mux.Unlock()
 
 				// flush any pending logs, then stop accepting new onces
-				lgr.Flush()
+				lgr.drainPending()
 				lgr.blockLogs = true
 				close(lgr.logs)
 			}()
+			for _, output := range lgr.getOutputs() {
+				output.close()
+			}
 			return
 		}
 	}
 }
 
+// log queues msg for the writer goroutine, according to the sampling and backpressure policies
+func (lgr *AsyncLogger) log(msg logMessage) {
+	if !lgr.namespaceAllows(msg) || !lgr.sampler.allow(msg) {
+		return
+	}
+	msg = lgr.withSource(msg)
+	lgr.withLogsNotBlocked(func() {
+		lgr.enqueue(msg)
+	})
+}
+
 func (lgr *AsyncLogger) withLogsNotBlocked(f func()) {
 	lgr.mux.RLock()
 	defer lgr.mux.RUnlock()
@@ -184,34 +352,69 @@ func (lgr *AsyncLogger) withLogsNotBlocked(f func()) {
 	f()
 }
 
-func expandOrStripAnsi(t string, expand bool) (string, bool) {
-	modified := false
-	for {
-		n := strings.IndexByte(t, '{')
+// maxColorSpecLen is the maximum length of the color spec of a color tag, e.g. "red+b:white+h"
+const maxColorSpecLen = 32
+
+// isColorSpec reports whether spec is "reset", "off", or an ansi color spec like "red", "yellow+b", "white+h:red" or
+// "208", see github.com/mgutz/ansi
+func isColorSpec(spec string) bool {
+	if spec == "reset" || spec == "off" {
+		return true
+	}
+	if len(spec) > maxColorSpecLen {
+		return false
+	}
+	fg, bg, hasBg := strings.Cut(spec, ":")
+	return isColorPart(fg) && (!hasBg || isColorPart(bg))
+}
+
+func isColorPart(part string) bool {
+	name, attributes, _ := strings.Cut(part, "+")
+	if _, ok := ansi.Colors[name]; !ok {
+		return false
+	}
+	return strings.Trim(attributes, "bdBuish") == ""
+}
+
+// colorTags returns the positions of the color tags of t, like {red} or {reset}; other text in braces is not a tag
+func colorTags(t string) [][2]int {
+	var tags [][2]int
+	for from := 0; ; {
+		n := strings.IndexByte(t[from:], '{')
 		if n < 0 {
-			break
+			return tags
 		}
+		n += from
 		n1 := strings.IndexByte(t[n:], '}')
 		if n1 < 0 {
-			break
+			return tags
 		}
-		if n1 > 15 {
-			break
-		}
-
 		n1 += n
-		cc := ansi.ColorCode(t[n+1 : n1])
-		if len(cc) != 0 {
-			if !expand {
-				cc = ""
-			}
-			t = t[:n] + cc + t[n1+1:]
-			modified = true
+		if isColorSpec(t[n+1 : n1]) {
+			tags = append(tags, [2]int{n, n1 + 1})
+			from = n1 + 1
 		} else {
-			break
+			from = n + 1
+		}
+	}
+}
+
+func expandOrStripAnsi(t string, expand bool) (string, bool) {
+	tags := colorTags(t)
+	if len(tags) == 0 {
+		return t, false
+	}
+	var sb strings.Builder
+	last := 0
+	for _, tag := range tags {
+		sb.WriteString(t[last:tag[0]])
+		if expand {
+			sb.WriteString(ansi.ColorCode(t[tag[0]+1 : tag[1]-1]))
 		}
+		last = tag[1]
 	}
-	return t, modified
+	sb.WriteString(t[last:])
+	return sb.String(), true
 }
 
 func expandAnsi(t string) (string, bool) {
@@ -222,34 +425,76 @@ func stripAnsi(t string) (string, bool) {
 	return expandOrStripAnsi(t, false)
 }
 
+// ExpandAnsi replaces the color tags of t, like {red} or {reset}, with ansi escape codes
+func ExpandAnsi(t string) string {
+	t, _ = expandAnsi(t)
+	return t
+}
+
+// StripAnsi removes the color tags of t, like {red} or {reset}
+func StripAnsi(t string) string {
+	t, _ = stripAnsi(t)
+	return t
+}
+
+// writeLogAccordingToLevel hands msg over to the queues of the outputs accepting it. Each output is written by its own
+// goroutine, so a slow output does not delay the others: when its queue is full, the message is dropped for it.
 func (lgr *AsyncLogger) writeLogAccordingToLevel(msg logMessage) {
-	var wg sync.WaitGroup
-	for _, outputConfig := range lgr.outputs {
-		if ok := outputConfig.filter(msg.namespace); !ok {
+	if msg.flushed != nil {
+		// waited for in the background, so that a stalled output does not hold back the others
+		go func() {
+			lgr.flushOutputs()
+			close(msg.flushed)
+		}()
+		return
+	}
+
+	msg = lgr.redactor.redact(msg)
+	if lgr.cache != nil {
+		lgr.cache.add(lgr.cacheFormatter.String(msg))
+	}
+
+	// FATAL messages are waited for, but not forever, as the process exits after them
+	var deadline time.Time
+	if msg.level == LogLevelFatal {
+		deadline = time.Now().Add(LogFatalFlushTimeout)
+	}
+	routed, isRouted := lgr.getNamespaceSettings().outputs.Lookup(msg.namespace)
+	for _, output := range lgr.getOutputs() {
+		if isRouted && !containsOutput(routed, output.name) {
 			continue
 		}
-		if uint(outputConfig.minLevel) > uint(msg.level) {
-			return
+		if output.accepts(msg.namespace, msg.level) {
+			output.enqueue(msg, deadline)
 		}
+	}
 
-		wg.Add(1)
-		go func(output logOutput) {
-			defer wg.Done()
-			txt := output.formatter.String(msg)
-
-			if output.dst == defaultScreenDst { // it means screen
-				DefaultScreenOutputFunc(output.dst, txt)
-			} else {
-				_, _ = io.WriteString(output.dst, txt)
-			}
+	if msg.level == LogLevelFatal {
+		lgr.onFatal(msg, deadline)
+	}
+}
 
-		}(outputConfig)
+// flushOutputs waits until the outputs have written everything queued so far
+func (lgr *AsyncLogger) flushOutputs() {
+	for _, output := range lgr.getOutputs() {
+		output.flush()
 	}
+}
 
-	wg.Wait()
-	if msg.level == LogLevelFatal {
-		lgr.Flush()
-		os.Exit(1)
+// flushOutputsUntil is flushOutputs waiting until deadline at most; it reports whether the outputs were flushed
+func (lgr *AsyncLogger) flushOutputsUntil(deadline time.Time) bool {
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		lgr.flushOutputs()
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-flushed:
+		return true
+	case <-timer.C:
+		return false
 	}
 }
 
@@ -257,12 +502,11 @@ type logMessage struct {
 	level           LogLevel
 	namespace       string
 	message         string
+	format          string // format string, or message if there is none; the sampling key, see SetSampling
+	fields          []Field
 	unixTimestampNS int64
-}
+	caller          Caller // captured if an output asks for it, see SourceInfo
+	stack           string
 
-type logOutput struct {
-	filter    FilterFunc
-	dst       io.Writer
-	minLevel  LogLevel
-	formatter Formatter
+	flushed chan struct{} // if set, this is not a log but a flush request, closed once everything before it is written
 }
@@ -23,10 +23,10 @@ func TestAsyncLogger(t *testing.T) {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 	var capturedOutput bytes.Buffer
-	var outputs []logOutput
+	var outputs []*logOutput
 	testLogger := &AsyncLogger{
 		logs: make(chan logMessage),
-		outputs: append(outputs, logOutput{
+		outputs: append(outputs, &logOutput{
 			dst:       &capturedOutput,
 			minLevel:  LogLevelDebug,
 			filter:    FilterMatchAll,
@@ -43,7 +43,7 @@ func TestAsyncLogger(t *testing.T) {
 	})
 
 	// ensure all the logs are written before comparing
-	time.Sleep(1 * time.Millisecond)
+	testLogger.Flush()
 
 	expectedOutput := "2020-09-29 19:05:07.123 (test-logger) [DEBUG]: debugf with args.\n" +
 		"2020-09-29 19:05:07.123 (test-logger) [INFO]: infof with args.\n" +
@@ -63,10 +63,10 @@ func TestAsyncLoggerLogLevels(t *testing.T) {
 	defer cancelFunc()
 
 	var capturedOutput bytes.Buffer
-	var outputs []logOutput
+	var outputs []*logOutput
 	testLogger := &AsyncLogger{
 		logs: make(chan logMessage),
-		outputs: append(outputs, logOutput{
+		outputs: append(outputs, &logOutput{
 			dst:       &capturedOutput,
 			minLevel:  LogLevelWarn,
 			filter:    FilterMatchAll,
@@ -81,7 +81,7 @@ func TestAsyncLoggerLogLevels(t *testing.T) {
 	testLogger.Warnf("test-logger", "this log should show")
 
 	// ensure all the logs are written before comparing
-	time.Sleep(1 * time.Millisecond)
+	testLogger.Flush()
 
 	expectedOutput := "2020-09-29 19:05:07.123 (test-logger) [WARN]: this log should show\n"
 	assert.Equal(t, expectedOutput, capturedOutput.String())
@@ -98,7 +98,7 @@ func TestSpecialPrefix(t *testing.T) {
 
 	// two test outputs: one that is the "screen", one that is the "file"
 	var screenBuffer, fileBuffer bytes.Buffer
-	outputs := []logOutput{
+	outputs := []*logOutput{
 		// this should get all except where the namespace is or starts with "_"
 		{dst: &screenBuffer, minLevel: LogLevelDebug, filter: FilterUnderscore, formatter: NewSimpleFormatter(false, true)},
 
@@ -120,7 +120,7 @@ func TestSpecialPrefix(t *testing.T) {
 	testLogger.Infof("__", "should not show in screen")
 
 	// ensure all the logs are written before comparing
-	time.Sleep(1 * time.Millisecond)
+	testLogger.Flush()
 
 	expectedDumpFromFile := "" +
 		"2020-09-29 19:05:07.123 (ns) [INFO]: should show everywhere\n" +
@@ -137,6 +137,41 @@ func TestSpecialPrefix(t *testing.T) {
 	assert.Equal(t, expectedDumpFromFile, fileBuffer.String())
 }
 
+func TestAsyncLoggerWith(t *testing.T) {
+	// stub the clock
+	currentTime, _ := time.Parse(time.RFC3339Nano, "2020-09-29T19:05:07.123456Z")
+	currentClock = testClock(currentTime)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	var capturedOutput bytes.Buffer
+	var outputs []*logOutput
+	testLogger := &AsyncLogger{
+		logs: make(chan logMessage),
+		outputs: append(outputs, &logOutput{
+			dst:       &capturedOutput,
+			minLevel:  LogLevelDebug,
+			filter:    FilterMatchAll,
+			formatter: NewSimpleFormatter(false, true),
+		}),
+	}
+	go testLogger.handleLogs(ctx)
+
+	child := testLogger.With("exchange", "binance")
+	child.Infow("test-logger", "order sent", "orderId", 42, F("side", "buy"))
+	child.With("symbol", "BTC").Warnf("test-logger", "slow ack %dms", 12)
+	testLogger.Infow("test-logger", "odd args", "dangling")
+
+	testLogger.Flush()
+
+	expectedOutput := "2020-09-29 19:05:07.123 (test-logger) [INFO]: order sent exchange=binance orderId=42 side=buy\n" +
+		"2020-09-29 19:05:07.123 (test-logger) [WARN]: slow ack 12ms exchange=binance symbol=BTC\n" +
+		"2020-09-29 19:05:07.123 (test-logger) [INFO]: odd args !BADKEY=dangling\n"
+	assert.Equal(t, expectedOutput, capturedOutput.String())
+}
+
 var testLogger Logger
 var stopFunc context.CancelFunc
 
@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrewelkin/trilib/utils/metrics"
+)
+
+// BackpressurePolicy selects what happens to a log call when the pending log buffer (LogBufferSize) is full
+type BackpressurePolicy uint32
+
+const (
+	// BackpressureBlock blocks the calling goroutine until there is room in the buffer
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureDropNewest drops the message being logged
+	BackpressureDropNewest
+
+	// BackpressureDropOldest drops the oldest pending messages to make room for the message being logged
+	BackpressureDropOldest
+
+	// BackpressureDropBelowLevel drops the message being logged if its level is below the policy level, and blocks
+	// otherwise
+	BackpressureDropBelowLevel
+)
+
+var backpressurePolicies = map[BackpressurePolicy]string{
+	BackpressureBlock:          "block",
+	BackpressureDropNewest:     "drop-newest",
+	BackpressureDropOldest:     "drop-oldest",
+	BackpressureDropBelowLevel: "drop-below-level",
+}
+
+func (p BackpressurePolicy) String() string {
+	return backpressurePolicies[p]
+}
+
+// ParseBackpressurePolicy parses one of "block", "drop-newest", "drop-oldest" or "drop-below-level"
+func ParseBackpressurePolicy(raw string) (BackpressurePolicy, error) {
+	for policy, name := range backpressurePolicies {
+		if strings.EqualFold(raw, name) {
+			return policy, nil
+		}
+	}
+	return BackpressureBlock, fmt.Errorf("unknown backpressure policy %q", raw)
+}
+
+// LogDropReportInterval is how often the number of messages dropped by the backpressure policy is reported as a
+// WARN log in LogDropNamespace and emitted to the metrics
+var LogDropReportInterval = 10 * time.Second
+
+// LogDropNamespace is the namespace of the dropped messages report
+var LogDropNamespace = "logger"
+
+// droppedMetric is emitted on each report with the number of messages dropped since the previous one, by level
+var droppedMetric = metrics.MetricDefinition{
+	MetricType: metrics.Counter,
+	Namespace:  "logger",
+	Name:       "dropped_messages",
+	Help:       "Number of log messages dropped because the log buffer was full",
+	LabelNames: []string{"level"},
+}
+
+// SetBackpressurePolicy sets what happens when the pending log buffer is full. level is only used by
+// BackpressureDropBelowLevel. FATAL messages are never dropped. The policy does not apply to the output queues: a
+// message is dropped for an output whose queue is full, and counted in its stats (see OutputStats.Dropped).
+func (lgr *AsyncLogger) SetBackpressurePolicy(policy BackpressurePolicy, level LogLevel) {
+	atomic.StoreUint32(&lgr.dropLevel, uint32(level))
+	atomic.StoreUint32(&lgr.backpressure, uint32(policy))
+}
+
+// SetMetrics sets where the dropped messages counters are emitted; by default the global metrics are used, if any
+func (lgr *AsyncLogger) SetMetrics(m metrics.Metrics) {
+	lgr.metricsMux.Lock()
+	defer lgr.metricsMux.Unlock()
+	lgr.metrics = m
+}
+
+// Dropped returns the total number of messages dropped by the backpressure policy
+func (lgr *AsyncLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&lgr.droppedTotal)
+}
+
+// enqueue sends msg to the writer goroutine according to the backpressure policy
+func (lgr *AsyncLogger) enqueue(msg logMessage) {
+	policy := BackpressurePolicy(atomic.LoadUint32(&lgr.backpressure))
+	if policy == BackpressureBlock || msg.level == LogLevelFatal || cap(lgr.logs) == 0 {
+		lgr.logs <- msg
+		return
+	}
+
+	select {
+	case lgr.logs <- msg:
+		return
+	default:
+	}
+
+	switch policy {
+	case BackpressureDropNewest:
+		lgr.countDropped(msg.level)
+	case BackpressureDropBelowLevel:
+		if uint32(msg.level) < atomic.LoadUint32(&lgr.dropLevel) {
+			lgr.countDropped(msg.level)
+		} else {
+			lgr.logs <- msg
+		}
+	case BackpressureDropOldest:
+		lgr.evictOldest(msg)
+	}
+}
+
+// evictOldest drops the oldest pending messages until msg fits in the buffer. FATAL messages and flush requests are
+// never dropped: they are held ahead of the buffer, in order, and the next oldest message is dropped instead.
+func (lgr *AsyncLogger) evictOldest(msg logMessage) {
+	// the writer goroutine only waits for a message with the read lock when the buffer is empty, and msg fits then
+	for !lgr.evictMux.TryLock() {
+		select {
+		case lgr.logs <- msg:
+			return
+		default:
+			runtime.Gosched()
+		}
+	}
+	defer lgr.evictMux.Unlock()
+
+	for {
+		select {
+		case lgr.logs <- msg:
+			return
+		default:
+		}
+		select {
+		case old := <-lgr.logs:
+			if old.level == LogLevelFatal || old.flushed != nil {
+				lgr.held = append(lgr.held, old)
+			} else {
+				lgr.countDropped(old.level)
+			}
+		default:
+		}
+	}
+}
+
+func (lgr *AsyncLogger) countDropped(level LogLevel) {
+	if int(level) < len(lgr.dropped) {
+		atomic.AddUint64(&lgr.dropped[level], 1)
+	}
+	atomic.AddUint64(&lgr.droppedTotal, 1)
+}
+
+// reportDropped periodically logs and emits the number of dropped messages, until ctx is done
+func (lgr *AsyncLogger) reportDropped(ctx context.Context) {
+	ticker := time.NewTicker(LogDropReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lgr.reportDroppedOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (lgr *AsyncLogger) reportDroppedOnce(ctx context.Context) {
+	var counts [LogLevelFatal + 1]uint64
+	var total uint64
+	var details []string
+	for level := range counts {
+		counts[level] = atomic.SwapUint64(&lgr.dropped[level], 0)
+		if counts[level] > 0 {
+			total += counts[level]
+			details = append(details, fmt.Sprintf("%s=%d", strings.ToLower(logLevels[LogLevel(level)]), counts[level]))
+		}
+	}
+	if total == 0 {
+		return
+	}
+
+	// the report itself waits for room in the buffer
+	report := newLogMessage(LogLevelWarn, LogDropNamespace, "dropped %d log messages (%s) due to backpressure policy %s",
+		total, strings.Join(details, ", "), BackpressurePolicy(atomic.LoadUint32(&lgr.backpressure)))
+	lgr.withLogsNotBlocked(func() {
+		select {
+		case lgr.logs <- report:
+		case <-ctx.Done():
+		}
+	})
+
+	lgr.metricsMux.Lock()
+	m := lgr.metrics
+	lgr.metricsMux.Unlock()
+	if m == nil {
+		m = metrics.GetGlobalMetrics()
+	}
+	if m == nil {
+		return
+	}
+	for level, count := range counts {
+		if count == 0 {
+			continue
+		}
+		metric := droppedMetric
+		metric.LabelValues = []string{strings.ToLower(logLevels[LogLevel(level)])}
+		_ = m.Emit(&metric, float64(count))
+	}
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andrewelkin/trilib/utils/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drainMessages(lgr *AsyncLogger) []string {
+	var messages []string
+	for {
+		logs := lgr.receiveLogs(nil)
+		if len(logs) == 0 {
+			return messages
+		}
+		for _, msg := range logs {
+			messages = append(messages, msg.message)
+		}
+	}
+}
+
+func TestBackpressurePolicies(t *testing.T) {
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 2)}
+
+	testLogger.SetBackpressurePolicy(BackpressureDropNewest, LogLevelDebug)
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		testLogger.Infof("test-logger", msg)
+	}
+	assert.Equal(t, []string{"1", "2"}, drainMessages(testLogger))
+	assert.Equal(t, uint64(2), testLogger.Dropped())
+
+	testLogger.SetBackpressurePolicy(BackpressureDropOldest, LogLevelDebug)
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		testLogger.Infof("test-logger", msg)
+	}
+	assert.Equal(t, []string{"3", "4"}, drainMessages(testLogger))
+	assert.Equal(t, uint64(4), testLogger.Dropped())
+
+	// a pending FATAL message is kept in its place, the next oldest message is dropped instead
+	testLogger.logs <- newLogMessage(LogLevelFatal, "test-logger", "fatal")
+	for _, msg := range []string{"1", "2", "3"} {
+		testLogger.Infof("test-logger", msg)
+	}
+	assert.Equal(t, []string{"fatal", "2", "3"}, drainMessages(testLogger))
+	assert.Equal(t, uint64(5), testLogger.Dropped())
+
+	testLogger.SetBackpressurePolicy(BackpressureDropBelowLevel, LogLevelWarn)
+	testLogger.Infof("test-logger", "1")
+	testLogger.Infof("test-logger", "2")
+	testLogger.Infof("test-logger", "dropped")
+	go testLogger.Warnf("test-logger", "kept")
+	assert.Equal(t, "1", (<-testLogger.logs).message)
+	assert.Equal(t, "2", (<-testLogger.logs).message)
+	assert.Equal(t, "kept", (<-testLogger.logs).message)
+	assert.Equal(t, uint64(6), testLogger.Dropped())
+}
+
+type recordingMetrics struct {
+	emitted map[string]float64
+}
+
+func (rm *recordingMetrics) Emit(metric *metrics.MetricDefinition, value float64) error {
+	rm.emitted[metric.Name+"/"+metric.LabelValues[0]] += value
+	return nil
+}
+
+func (rm *recordingMetrics) Flush() {}
+
+func TestBackpressureReport(t *testing.T) {
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 1)}
+	m := &recordingMetrics{emitted: map[string]float64{}}
+	testLogger.SetMetrics(m)
+	testLogger.SetBackpressurePolicy(BackpressureDropNewest, LogLevelDebug)
+
+	testLogger.Infof("test-logger", "kept")
+	testLogger.Infof("test-logger", "dropped")
+	testLogger.Debugf("test-logger", "dropped")
+	testLogger.Debugf("test-logger", "dropped")
+	assert.Equal(t, []string{"kept"}, drainMessages(testLogger))
+
+	testLogger.reportDroppedOnce(context.Background())
+	messages := drainMessages(testLogger)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "dropped 3 log messages (debug=2, info=1) due to backpressure policy drop-newest", messages[0])
+	assert.Equal(t, map[string]float64{"dropped_messages/debug": 2, "dropped_messages/info": 1}, m.emitted)
+
+	// counters are reset after each report
+	testLogger.reportDroppedOnce(context.Background())
+	assert.Empty(t, drainMessages(testLogger))
+}
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+)
+
+// childLogger is created by AsyncLogger.With and AsyncLogger.Named; it shares the parent's queue and outputs and
+// attaches its fields to every message it logs, in namespaces under its own.
+type childLogger struct {
+	parent    *AsyncLogger
+	fields    []Field
+	namespace string // see Named
+}
+
+func (cl *childLogger) logf(level LogLevel, namespace, format string, a ...interface{}) string {
+	message := fmt.Sprintf(format, a...)
+	msg := newLogMessageW(level, JoinNamespace(cl.namespace, namespace), message, cl.fields)
+	msg.format = format
+	cl.parent.log(msg)
+	return message
+}
+
+func (cl *childLogger) logw(level LogLevel, namespace, msg string, keysAndValues []interface{}) {
+	cl.parent.log(newLogMessageW(level, JoinNamespace(cl.namespace, namespace), msg, appendFields(cl.fields, fieldsFromArgs(keysAndValues))))
+}
+
+// Debugf implements Logger
+func (cl *childLogger) Debugf(namespace, format string, a ...interface{}) {
+	cl.logf(LogLevelDebug, namespace, format, a...)
+}
+
+// Infof implements Logger
+func (cl *childLogger) Infof(namespace, format string, a ...interface{}) {
+	cl.logf(LogLevelInfo, namespace, format, a...)
+}
+
+// Warnf implements Logger
+func (cl *childLogger) Warnf(namespace, format string, a ...interface{}) {
+	cl.logf(LogLevelWarn, namespace, format, a...)
+}
+
+// Errorf implements Logger
+// Applies the error policy of the parent logger, see SetErrorPolicy
+func (cl *childLogger) Errorf(namespace, format string, a ...interface{}) {
+	cl.parent.onError(JoinNamespace(cl.namespace, namespace), cl.logf(LogLevelError, namespace, format, a...))
+}
+
+// Fatalf implements Logger
+func (cl *childLogger) Fatalf(namespace, format string, a ...interface{}) {
+	cl.logf(LogLevelFatal, namespace, format, a...)
+}
+
+// Debugw implements Logger
+func (cl *childLogger) Debugw(namespace, msg string, keysAndValues ...interface{}) {
+	cl.logw(LogLevelDebug, namespace, msg, keysAndValues)
+}
+
+// Infow implements Logger
+func (cl *childLogger) Infow(namespace, msg string, keysAndValues ...interface{}) {
+	cl.logw(LogLevelInfo, namespace, msg, keysAndValues)
+}
+
+// Warnw implements Logger
+func (cl *childLogger) Warnw(namespace, msg string, keysAndValues ...interface{}) {
+	cl.logw(LogLevelWarn, namespace, msg, keysAndValues)
+}
+
+// Errorw implements Logger
+// Applies the error policy of the parent logger, see SetErrorPolicy
+func (cl *childLogger) Errorw(namespace, msg string, keysAndValues ...interface{}) {
+	cl.logw(LogLevelError, namespace, msg, keysAndValues)
+	cl.parent.onError(JoinNamespace(cl.namespace, namespace), msg)
+}
+
+// Fatalw implements Logger
+func (cl *childLogger) Fatalw(namespace, msg string, keysAndValues ...interface{}) {
+	cl.logw(LogLevelFatal, namespace, msg, keysAndValues)
+}
+
+// With implements Logger; the returned logger carries both the parent's and the new fields
+func (cl *childLogger) With(keysAndValues ...interface{}) Logger {
+	return &childLogger{parent: cl.parent, fields: appendFields(cl.fields, fieldsFromArgs(keysAndValues)), namespace: cl.namespace}
+}
+
+// Named implements Logger; the returned logger logs under the namespace of cl, with its fields
+func (cl *childLogger) Named(name string) Logger {
+	return &childLogger{parent: cl.parent, fields: cl.fields, namespace: JoinNamespace(cl.namespace, name)}
+}
+
+// AddOutput implements Logger; outputs are shared with the parent logger
+func (cl *childLogger) AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, opts ...interface{}) OutputHandle {
+	return cl.parent.AddOutput(filter, output, minLevel, ansi, trailCR, opts...)
+}
+
+// Flush implements Logger
+func (cl *childLogger) Flush() {
+	cl.parent.Flush()
+}
+
+// NewLine implements Logger
+func (cl *childLogger) NewLine() {
+	cl.parent.NewLine()
+}
+
+// NoDateNextLine implements Logger
+func (cl *childLogger) NoDateNextLine() {
+	cl.parent.NoDateNextLine()
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+)
+
+// OutputDedup is an AddOutput option merging consecutive messages with the same namespace, level and message into
+// the first one and a "(repeated N times over D)" summary. The summary is written when a different message arrives,
+// on Flush, or at the latest after the OutputDedup duration (LogDedupInterval if <= 0).
+type OutputDedup time.Duration
+
+// LogDedupInterval is the default maximum delay of a repeat summary, see OutputDedup
+var LogDedupInterval = 5 * time.Second
+
+// deduper merges repeated messages of an output; used by the output goroutine only
+type deduper struct {
+	interval time.Duration
+	last     logMessage
+	hasLast  bool
+	repeats  int
+	lastNS   int64 // time of the last repeat
+}
+
+func newDeduper(interval time.Duration) *deduper {
+	if interval <= 0 {
+		interval = LogDedupInterval
+	}
+	return &deduper{interval: interval}
+}
+
+func sameMessage(a, b logMessage) bool {
+	return a.level == b.level && a.namespace == b.namespace && a.message == b.message
+}
+
+// add returns the messages to write for msg: nothing if it repeats the last one, otherwise the pending summary if
+// any, then msg
+func (d *deduper) add(msg logMessage) []logMessage {
+	if d.hasLast && sameMessage(d.last, msg) {
+		d.repeats++
+		d.lastNS = msg.unixTimestampNS
+		return nil
+	}
+	res := make([]logMessage, 0, 2)
+	if summary, ok := d.summary(); ok {
+		res = append(res, summary)
+	}
+	d.last, d.hasLast, d.repeats = msg, true, 0
+	return append(res, msg)
+}
+
+// summary returns the summary of the repeats since the last message written, if any; repeats that follow are
+// counted anew
+func (d *deduper) summary() (logMessage, bool) {
+	if d.repeats == 0 {
+		return logMessage{}, false
+	}
+	summary := d.last
+	summary.message = fmt.Sprintf("%s (repeated %v times over %s)", d.last.message, d.repeats,
+		time.Duration(d.lastNS-d.last.unixTimestampNS))
+	summary.unixTimestampNS = d.lastNS
+	d.last.unixTimestampNS = d.lastNS
+	d.repeats = 0
+	return summary, true
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while an output goroutine writes to it
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mux.Lock()
+	defer sb.mux.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mux.Lock()
+	defer sb.mux.Unlock()
+	return sb.buf.String()
+}
+
+func TestOutputDedup(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2020-09-29T19:05:07Z")
+	currentClock = testClock(now)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage)}
+	go testLogger.handleLogs(ctx)
+
+	var text, plain bytes.Buffer
+	json := &syncBuffer{}
+	testLogger.AddOutput(FilterMatchAll, &text, LogLevelDebug, false, true, OutputDedup(time.Hour))
+	testLogger.AddOutput(FilterMatchAll, &plain, LogLevelDebug, false, true)
+	testLogger.AddOutput(FilterMatchAll, json, LogLevelDebug, false, false, NewJsonFormatter(), OutputDedup(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		currentClock = testClock(now.Add(time.Duration(i) * time.Second))
+		testLogger.Infof("WS", "reconnecting")
+	}
+	testLogger.Warnf("WS", "reconnecting")
+	testLogger.Warnf("WS", "reconnecting")
+	testLogger.Warnf("MD", "reconnecting")
+	testLogger.Flush()
+
+	assert.Equal(t, strings.Join([]string{
+		"2020-09-29 19:05:07.000 (WS) [INFO]: reconnecting",
+		"2020-09-29 19:05:09.000 (WS) [INFO]: reconnecting (repeated 2 times over 2s)",
+		"2020-09-29 19:05:09.000 (WS) [WARN]: reconnecting",
+		"2020-09-29 19:05:09.000 (WS) [WARN]: reconnecting (repeated 1 times over 0s)",
+		"2020-09-29 19:05:09.000 (MD) [WARN]: reconnecting",
+	}, "\n")+"\n", text.String())
+	assert.Equal(t, 6, strings.Count(plain.String(), "\n"))
+
+	// the summary is written on a timer, without waiting for another message or a flush
+	json = &syncBuffer{}
+	testLogger.AddOutput(FilterMatchAll, json, LogLevelDebug, false, false, NewJsonFormatter(), OutputDedup(20*time.Millisecond))
+	testLogger.Infof("WS", "tick")
+	testLogger.Infof("WS", "tick")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(json.String(), `"message":"tick (repeated 1 times over 0s)"`)
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,194 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorPolicy selects what Errorf and Errorw do in the calling goroutine once the message is logged
+type ErrorPolicy uint32
+
+const (
+	// ErrorPolicyPanic panics with the message (default)
+	ErrorPolicyPanic ErrorPolicy = iota
+
+	// ErrorPolicyReturn returns normally
+	ErrorPolicyReturn
+
+	// ErrorPolicyHook calls the hook set with SetErrorPolicy, then returns
+	ErrorPolicyHook
+)
+
+var errorPolicies = map[ErrorPolicy]string{
+	ErrorPolicyPanic:  "panic",
+	ErrorPolicyReturn: "return",
+	ErrorPolicyHook:   "hook",
+}
+
+func (p ErrorPolicy) String() string {
+	return errorPolicies[p]
+}
+
+// ParseErrorPolicy parses one of "panic", "return" or "hook"
+func ParseErrorPolicy(raw string) (ErrorPolicy, error) {
+	for policy, name := range errorPolicies {
+		if strings.EqualFold(raw, name) {
+			return policy, nil
+		}
+	}
+	return ErrorPolicyPanic, fmt.Errorf("unknown error policy %q", raw)
+}
+
+// ErrorHook is called in the calling goroutine by Errorf and Errorw with ErrorPolicyHook
+type ErrorHook func(namespace, message string)
+
+// FatalHandler is called once on the first FATAL message, after it has been written to the outputs, to shut down
+// gracefully. The process exits when it returns or after the timeout set with SetFatalHandler, whichever comes first.
+// Messages logged by the handler are written as usual.
+type FatalHandler func(namespace, message string)
+
+// LogFatalTimeout is the default time given to the fatal handler before the process exits
+var LogFatalTimeout = 5 * time.Second
+
+// LogFatalFlushTimeout is the time given to the outputs to write the pending messages on a FATAL message, before the
+// fatal handler runs, and again once it has returned or timed out; the process exits anyway after it, e.g. if an
+// output is stuck
+var LogFatalFlushTimeout = 2 * time.Second
+
+// Failure is an Errorf/Errorw or Fatalf/Fatalw call recorded in test mode, see SetTestMode
+type Failure struct {
+	Level     LogLevel
+	Namespace string
+	Message   string
+}
+
+// osExit terminates the process after a FATAL message; replaced in tests
+var osExit = os.Exit
+
+// SetErrorPolicy sets what Errorf and Errorw do after logging; hook is only used by ErrorPolicyHook
+func (lgr *AsyncLogger) SetErrorPolicy(policy ErrorPolicy, hook ErrorHook) {
+	lgr.failureMux.Lock()
+	defer lgr.failureMux.Unlock()
+	lgr.errorHook = hook
+	atomic.StoreUint32(&lgr.errorPolicy, uint32(policy))
+}
+
+// SetFatalHandler sets the handler run on the first FATAL message before the process exits. A timeout <= 0 means
+// LogFatalTimeout. Without a handler, the process exits as soon as the message is written.
+func (lgr *AsyncLogger) SetFatalHandler(handler FatalHandler, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = LogFatalTimeout
+	}
+	lgr.failureMux.Lock()
+	defer lgr.failureMux.Unlock()
+	lgr.fatalHandler = handler
+	lgr.fatalTimeout = timeout
+}
+
+// SetTestMode makes Errorf/Errorw return and FATAL messages not exit the process, whatever the policy and fatal
+// handler; the calls are recorded instead, see Failures
+func (lgr *AsyncLogger) SetTestMode(enabled bool) {
+	lgr.failureMux.Lock()
+	defer lgr.failureMux.Unlock()
+	lgr.testMode = enabled
+}
+
+// Failures returns the error and fatal calls recorded in test mode. FATAL messages are recorded once written, so call
+// Flush first.
+func (lgr *AsyncLogger) Failures() []Failure {
+	lgr.failureMux.Lock()
+	defer lgr.failureMux.Unlock()
+	return append([]Failure(nil), lgr.failures...)
+}
+
+// recordFailure records the failure if in test mode
+func (lgr *AsyncLogger) recordFailure(level LogLevel, namespace, message string) bool {
+	lgr.failureMux.Lock()
+	defer lgr.failureMux.Unlock()
+	if !lgr.testMode {
+		return false
+	}
+	lgr.failures = append(lgr.failures, Failure{Level: level, Namespace: namespace, Message: message})
+	return true
+}
+
+// onError applies the error policy after an ERROR message has been logged by Errorf or Errorw. The message is redacted
+// first, as it leaves the logger through the panic, the hook or the recorded failures.
+func (lgr *AsyncLogger) onError(namespace, message string) {
+	message = lgr.redactor.redactText(message)
+	if lgr.recordFailure(LogLevelError, namespace, message) {
+		return
+	}
+	switch ErrorPolicy(atomic.LoadUint32(&lgr.errorPolicy)) {
+	case ErrorPolicyReturn:
+	case ErrorPolicyHook:
+		lgr.failureMux.Lock()
+		hook := lgr.errorHook
+		lgr.failureMux.Unlock()
+		if hook != nil {
+			hook(namespace, message)
+		}
+	default:
+		panic(message)
+	}
+}
+
+// onFatal is called from the writer goroutine once a FATAL message has been handed over to the outputs. The messages
+// already queued are written until deadline at most, so that a stuck output or a busy producer cannot delay the exit.
+func (lgr *AsyncLogger) onFatal(msg logMessage, deadline time.Time) {
+	if lgr.recordFailure(LogLevelFatal, msg.namespace, msg.message) {
+		return
+	}
+
+	lgr.drainQueued(deadline)
+	lgr.autoDumpCache(fmt.Sprintf("fatal: (%s) %s", msg.namespace, msg.message))
+
+	lgr.failureMux.Lock()
+	handler, timeout := lgr.fatalHandler, lgr.fatalTimeout
+	lgr.failureMux.Unlock()
+	if handler == nil {
+		osExit(1)
+		return
+	}
+
+	// the writer goroutine keeps going, so that the handler can log
+	lgr.fatalOnce.Do(func() {
+		go lgr.shutdown(handler, timeout, msg)
+	})
+}
+
+// shutdown runs the fatal handler, waits for it at most timeout, then for the outputs at most LogFatalFlushTimeout,
+// then exits
+func (lgr *AsyncLogger) shutdown(handler FatalHandler, timeout time.Duration, msg logMessage) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(os.Stderr, "fatal handler panicked: %v\n", r)
+			}
+		}()
+		handler(msg.namespace, msg.message)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Fprintf(os.Stderr, "fatal handler did not return within %v, exiting\n", timeout)
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		lgr.Flush()
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(LogFatalFlushTimeout):
+		fmt.Fprintf(os.Stderr, "log outputs not flushed within %v, exiting\n", LogFatalFlushTimeout)
+	}
+	osExit(1)
+}
@@ -0,0 +1,205 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFailureTestLogger(ctx context.Context, dst *bytes.Buffer) *AsyncLogger {
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 16)}
+	testLogger.AddOutput(FilterMatchAll, dst, LogLevelDebug, false, true, NewJsonFormatter())
+	go testLogger.handleLogs(ctx)
+	return testLogger
+}
+
+func TestErrorPolicy(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	var capturedOutput bytes.Buffer
+	testLogger := newFailureTestLogger(ctx, &capturedOutput)
+
+	assert.PanicsWithValue(t, "boom 1", func() { testLogger.Errorf("test-logger", "boom %d", 1) })
+
+	testLogger.SetErrorPolicy(ErrorPolicyReturn, nil)
+	assert.NotPanics(t, func() { testLogger.Errorw("test-logger", "boom 2", "key", "value") })
+	assert.NotPanics(t, func() { testLogger.With("key", "value").Errorf("test-logger", "boom 3") })
+
+	var hooked []string
+	testLogger.SetErrorPolicy(ErrorPolicyHook, func(namespace, message string) {
+		hooked = append(hooked, namespace+": "+message)
+	})
+	testLogger.Errorf("test-logger", "boom 4")
+	testLogger.With("key", "value").Errorw("test-logger", "boom 5")
+	assert.Equal(t, []string{"test-logger: boom 4", "test-logger: boom 5"}, hooked)
+
+	testLogger.Flush()
+	for _, message := range []string{"boom 1", "boom 2", "boom 3", "boom 4", "boom 5"} {
+		assert.Contains(t, capturedOutput.String(), message)
+	}
+
+	policy, err := ParseErrorPolicy("Return")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorPolicyReturn, policy)
+	_, err = ParseErrorPolicy("ignore")
+	assert.Error(t, err)
+}
+
+func TestFatalHandler(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+	defer func() { osExit = os.Exit }()
+
+	var capturedOutput bytes.Buffer
+	testLogger := newFailureTestLogger(ctx, &capturedOutput)
+	testLogger.SetFatalHandler(func(namespace, message string) {
+		testLogger.Infof("shutdown", "stopping after %s", message)
+	}, time.Second)
+
+	testLogger.Fatalf("test-logger", "out of memory")
+	assert.Equal(t, 1, <-exited)
+	assert.Contains(t, capturedOutput.String(), "out of memory")
+	assert.Contains(t, capturedOutput.String(), "stopping after out of memory")
+}
+
+func TestFatalHandlerTimeout(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+	defer func() { osExit = os.Exit }()
+
+	var capturedOutput bytes.Buffer
+	testLogger := newFailureTestLogger(ctx, &capturedOutput)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	testLogger.SetFatalHandler(func(namespace, message string) {
+		<-stuck
+	}, 10*time.Millisecond)
+
+	start := time.Now()
+	testLogger.Fatalw("test-logger", "out of memory")
+	assert.Equal(t, 1, <-exited)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
+
+func TestFatalHandlerStuckOutput(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+	defer func() { osExit = os.Exit }()
+	defer func(timeout time.Duration) { LogFatalFlushTimeout = timeout }(LogFatalFlushTimeout)
+	LogFatalFlushTimeout = 10 * time.Millisecond
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	testLogger := newFailureTestLogger(ctx, &bytes.Buffer{})
+	testLogger.AddOutput(FilterMatchAll, writerFunc(func(p []byte) (int, error) {
+		if bytes.Contains(p, []byte("stuck")) {
+			<-stuck
+		}
+		return len(p), nil
+	}), LogLevelDebug, false, true)
+	testLogger.SetFatalHandler(func(namespace, message string) {
+		testLogger.Infof("shutdown", "stuck output")
+	}, time.Second)
+
+	testLogger.Fatalf("test-logger", "out of memory")
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process did not exit")
+	}
+}
+
+func TestFatalBlockedOutput(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+	defer func() { osExit = os.Exit }()
+	defer func(timeout time.Duration) { LogFatalFlushTimeout = timeout }(LogFatalFlushTimeout)
+	LogFatalFlushTimeout = 10 * time.Millisecond
+
+	var capturedOutput bytes.Buffer
+	testLogger := newFailureTestLogger(ctx, &capturedOutput)
+	stuck := &blockingWriter{release: make(chan struct{}), waiting: make(chan struct{}, 1)}
+	defer close(stuck.release)
+	handle := testLogger.AddOutput(FilterMatchAll, stuck, LogLevelDebug, false, true, OutputQueueSize(1))
+
+	// the output is stuck writing the first message, with the second one queued, before the FATAL message
+	testLogger.Infof("test-logger", "being written")
+	<-stuck.waiting
+	testLogger.Infof("test-logger", "queued")
+	testLogger.Infof("test-logger", "dropped")
+	assert.Eventually(t, func() bool {
+		return handle.Stats().Dropped == 1
+	}, time.Second, time.Millisecond)
+
+	// a busy producer does not delay the exit either
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				testLogger.Infof("test-logger", "busy")
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	testLogger.Fatalf("test-logger", "out of memory")
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process did not exit")
+	}
+	assert.GreaterOrEqual(t, handle.Stats().Dropped, uint64(2))
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestFailureTestMode(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	osExit = func(code int) { t.Fatalf("unexpected exit %d", code) }
+	defer func() { osExit = os.Exit }()
+
+	var capturedOutput bytes.Buffer
+	testLogger := newFailureTestLogger(ctx, &capturedOutput)
+	testLogger.SetTestMode(true)
+
+	assert.NotPanics(t, func() { testLogger.Errorf("test-logger", "boom") })
+	testLogger.Fatalf("test-logger", "out of memory")
+	testLogger.Infof("test-logger", "still running")
+	testLogger.Flush()
+
+	assert.Equal(t, []Failure{
+		{Level: LogLevelError, Namespace: "test-logger", Message: "boom"},
+		{Level: LogLevelFatal, Namespace: "test-logger", Message: "out of memory"},
+	}, testLogger.Failures())
+	assert.Contains(t, capturedOutput.String(), "still running")
+}
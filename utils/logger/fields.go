@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Field is a structured key/value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a shorthand for creating a Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// badKey is used for a trailing value that has no key, or for a key that is not a string
+const badKey = "!BADKEY"
+
+// fieldsFromArgs converts a list of alternating keys and values into fields. Field (and []Field) arguments are accepted
+// as-is and do not consume a value.
+func fieldsFromArgs(keysAndValues []interface{}) []Field {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, len(keysAndValues)/2+1)
+	for i := 0; i < len(keysAndValues); i++ {
+		switch kv := keysAndValues[i].(type) {
+		case Field:
+			fields = append(fields, kv)
+		case []Field:
+			fields = append(fields, kv...)
+		case string:
+			if i+1 < len(keysAndValues) {
+				fields = append(fields, Field{Key: kv, Value: keysAndValues[i+1]})
+				i++
+			} else {
+				fields = append(fields, Field{Key: badKey, Value: kv})
+			}
+		default:
+			fields = append(fields, Field{Key: badKey, Value: kv})
+		}
+	}
+	return fields
+}
+
+// appendFields returns a new slice with extra fields appended to base; base itself is never modified
+func appendFields(base []Field, extra []Field) []Field {
+	if len(extra) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return extra
+	}
+	fields := make([]Field, 0, len(base)+len(extra))
+	fields = append(fields, base...)
+	return append(fields, extra...)
+}
+
+// formatFieldValue renders a field value for text formats, quoting it if it contains spaces, quotes or '='
+func formatFieldValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatFieldsKV renders fields as " key=value key2=value2" (with a leading space), or "" when there are no fields
+func formatFieldsKV(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteByte(' ')
+		sb.WriteString(f.Key)
+		sb.WriteByte('=')
+		sb.WriteString(formatFieldValue(f.Value))
+	}
+	return sb.String()
+}
@@ -0,0 +1,410 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogChainPrefix starts the records written by a FileWriter in the signed mode, see FileWriterOptions.SigningKey
+const LogChainPrefix = "#LOGCHAIN "
+
+// LogCheckpointLines is the default number of lines between two checkpoints of a signed log file
+var LogCheckpointLines = 1000
+
+// LogCheckpointInterval is the default maximum time between two checkpoints of a signed log file, checked on write
+var LogCheckpointInterval = time.Minute
+
+// hashChain hash-chains the lines written to a file and signs checkpoints; guarded by FileWriter.mux
+//
+// A chain starts with a "#LOGCHAIN start time=T file=F day=D seq=N prev=P" record each time a file is opened: F and D
+// are the name and day of the file, N the number of the chain in the file from 1, and P the hash of the last
+// checkpoint written before, in this file or a previous one (a zero hash for the very first chain), so that chains
+// can't be removed unnoticed. Every line, the start record included, extends the chain: hash = SHA-256(previous hash +
+// line without its newline), from P. Checkpoint records "#LOGCHAIN checkpoint file=F day=D lines=N hash=H sig=S" are
+// not chained; S is the ed25519 signature of "file=F day=D lines=N hash=H", the number of lines and the hash of the
+// chain so far.
+type hashChain struct {
+	key       ed25519.PrivateKey
+	maxLines  int
+	maxDelay  time.Duration
+	file      *os.File          // file the chain was started in
+	name, day string            // name and day of file
+	seq       int               // number of the chain in file
+	last      [sha256.Size]byte // hash of the last checkpoint, the prev of the next chain
+	resumed   bool              // last was recovered from the files written before, see FileWriter.resumeChain
+	hash      [sha256.Size]byte
+	lines     int
+	signed    int
+	partial   []byte // line not terminated yet
+	lastCheck time.Time
+}
+
+func newHashChain(key *[ed25519.PrivateKeySize]byte, opts FileWriterOptions) *hashChain {
+	hc := &hashChain{key: ed25519.PrivateKey(key[:]), maxLines: opts.CheckpointLines, maxDelay: opts.CheckpointInterval}
+	if hc.maxLines <= 0 {
+		hc.maxLines = LogCheckpointLines
+	}
+	if hc.maxDelay <= 0 {
+		hc.maxDelay = LogCheckpointInterval
+	}
+	return hc
+}
+
+// chainLine extends hash with line
+func chainLine(hash [sha256.Size]byte, line []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(hash[:])
+	h.Write(line)
+	var res [sha256.Size]byte
+	copy(res[:], h.Sum(nil))
+	return res
+}
+
+// start starts chain number seq of file name, of day; returns the start record to write
+func (hc *hashChain) start(file *os.File, name, day string, seq int, now time.Time) []byte {
+	hc.file, hc.name, hc.day, hc.seq = file, name, day, seq
+	hc.hash = hc.last
+	hc.lines, hc.signed, hc.partial, hc.lastCheck = 0, 0, nil, now
+	record := []byte(fmt.Sprintf("%sstart time=%s file=%s day=%s seq=%d prev=%s\n", LogChainPrefix,
+		now.UTC().Format(time.RFC3339Nano), name, day, seq, hex.EncodeToString(hc.last[:])))
+	hc.add(record)
+	return record
+}
+
+// add chains the complete lines of data written to the file
+func (hc *hashChain) add(data []byte) {
+	hc.partial = append(hc.partial, data...)
+	for {
+		n := bytes.IndexByte(hc.partial, '\n')
+		if n < 0 {
+			break
+		}
+		hc.hash = chainLine(hc.hash, hc.partial[:n])
+		hc.lines++
+		hc.partial = hc.partial[n+1:]
+	}
+	if len(hc.partial) == 0 {
+		hc.partial = nil
+	}
+}
+
+// due reports whether a checkpoint should be written
+func (hc *hashChain) due(now time.Time) bool {
+	return hc.lines > hc.signed && (hc.lines-hc.signed >= hc.maxLines || now.Sub(hc.lastCheck) >= hc.maxDelay)
+}
+
+// checkpoint returns the checkpoint record of the lines chained so far, or nil if there is nothing new to sign or a
+// line is not terminated yet
+func (hc *hashChain) checkpoint(now time.Time) []byte {
+	if hc.lines == hc.signed || len(hc.partial) > 0 {
+		return nil
+	}
+	signed := checkpointMessage(hc.name, hc.day, hc.lines, hc.hash)
+	sig := ed25519.Sign(hc.key, []byte(signed))
+	hc.signed, hc.lastCheck, hc.last = hc.lines, now, hc.hash
+	return []byte(LogChainPrefix + "checkpoint " + signed + " sig=" + base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+func checkpointMessage(file, day string, lines int, hash [sha256.Size]byte) string {
+	return "file=" + file + " day=" + day + " lines=" + strconv.Itoa(lines) + " hash=" + hex.EncodeToString(hash[:])
+}
+
+// recordFields parses the "key=value" fields of a record
+func recordFields(record string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(record) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func parseChainHash(raw string) ([sha256.Size]byte, bool) {
+	var hash [sha256.Size]byte
+	decoded, err := hex.DecodeString(raw)
+	if err != nil || len(decoded) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], decoded)
+	return hash, true
+}
+
+// writeChained writes line to file in the signed mode: a start record first if the file has just been opened, then
+// line, then a checkpoint if due. Must be called with fw.mux held.
+func (fw *FileWriter) writeChained(file *os.File, line []byte) (int, error) {
+	now := time.Now()
+	if fw.chain.file != file {
+		name := fw.segmentFileName(fw.currentDay, fw.currentSegment)
+		seq := fw.resumeChain(name)
+		if err := fw.writeRecord(file, fw.chain.start(file, name, fw.currentDay, seq, now)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := file.Write(line)
+	fw.currentSize += int64(n)
+	fw.chain.add(line[:n])
+	if err != nil {
+		return n, err
+	}
+	if fw.chain.due(now) {
+		err = fw.writeRecord(file, fw.chain.checkpoint(now))
+	}
+	return n, err
+}
+
+// closeChain writes the final checkpoint of the current file, if any. Must be called with fw.mux held.
+func (fw *FileWriter) closeChain() {
+	if fw.chain == nil || fw.chain.file == nil || fw.chain.file != fw.currentFile {
+		return
+	}
+	if err := fw.writeRecord(fw.currentFile, fw.chain.checkpoint(time.Now())); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write log checkpoint: %v\n", err)
+	}
+	fw.chain.file = nil
+}
+
+// resumeChain returns the number of the next chain of the file name, counting the chains it already has, e.g. after a
+// restart. The first time, it also recovers the hash of the last checkpoint written to name or to a previous file, so
+// that the chains of successive processes are linked. Must be called with fw.mux held.
+func (fw *FileWriter) resumeChain(name string) int {
+	hc := fw.chain
+	if hc.name == name {
+		return hc.seq + 1 // reopened after Close
+	}
+	seq := 1
+	current := logFileInfo{day: fw.currentDay, segment: fw.currentSegment}
+	files := fw.listLogFiles()
+	for i := len(files) - 1; i >= 0; i-- {
+		lf := files[i]
+		if current.before(lf) {
+			continue
+		}
+		isCurrent := lf.name == name
+		if !isCurrent && hc.resumed {
+			break
+		}
+		chains, last, found := scanChain(path.Join(fw.basePath, lf.name))
+		if isCurrent {
+			seq += chains
+		}
+		if found && !hc.resumed {
+			hc.last, hc.resumed = last, true
+		}
+	}
+	hc.resumed = true
+	return seq
+}
+
+// scanChain returns the number of chains of a signed log file, and the hash of its last checkpoint if it has one
+func scanChain(filename string) (chains int, last [sha256.Size]byte, found bool) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, last, false
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(filename, compressedSuffix) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, last, false
+		}
+		defer zr.Close()
+		r = zr
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, LogChainPrefix+"start "):
+			chains++
+		case strings.HasPrefix(line, LogChainPrefix+"checkpoint "):
+			if hash, ok := parseChainHash(recordFields(line)["hash"]); ok {
+				last, found = hash, true
+			}
+		}
+	}
+	return chains, last, found
+}
+
+func (fw *FileWriter) writeRecord(file *os.File, record []byte) error {
+	if len(record) == 0 {
+		return nil
+	}
+	n, err := file.Write(record)
+	fw.currentSize += int64(n)
+	return err
+}
+
+// SignedLogReport is the result of the verification of a signed log file, see VerifySignedLog
+type SignedLogReport struct {
+	Chains      int    // start records, one per opening of the file
+	Checkpoints int    // valid checkpoints
+	Lines       int    // lines covered by a hash chain, start records included
+	Signed      int    // lines covered by a valid checkpoint
+	File        string // name of the file, as signed
+	Day         string // day of the file, as signed
+	Prev        string // hash the first chain continues, i.e. the last checkpoint of the previous file
+	Last        string // hash of the last checkpoint, continued by the next file; Prev if there is none
+}
+
+// Unsigned returns the number of lines written after the last checkpoint of their chain, e.g. by a process that
+// crashed; they can't be verified
+func (r SignedLogReport) Unsigned() int {
+	return r.Lines - r.Signed
+}
+
+// Continues reports whether r is the file written after prev, i.e. whether its first chain continues the last
+// checkpoint of prev; files removed in between, or whole chains removed at the end of prev, break the link
+func (r SignedLogReport) Continues(prev SignedLogReport) bool {
+	return r.Prev == prev.Last
+}
+
+// VerifySignedLog verifies a log written by a FileWriter in the signed mode against the ed25519 public key of its
+// SigningKey. It fails on the first line that was altered, inserted or removed before a checkpoint, on a chain that was
+// removed or does not continue the last checkpoint before it, or on a checkpoint that was not signed with the key.
+// Lines after the last checkpoint of a chain are reported as unsigned. Use SignedLogReport.Continues to check that
+// successive files are linked.
+func VerifySignedLog(r io.Reader, publicKey *[ed25519.PublicKeySize]byte) (report SignedLogReport, err error) {
+	var hash, last [sha256.Size]byte
+	inChain := false
+	chainLines, chainSigned := 0, 0
+	// the separator written when a file is reopened precedes a start record; any other line "======" is a log line
+	separatorLine := []byte(strings.TrimSuffix(separator, "\n"))
+	pendingSeparator := 0
+	endChain := func() {
+		report.Lines += chainLines
+		report.Signed += chainSigned
+		chainLines, chainSigned = 0, 0
+	}
+	defer func() {
+		report.Last = hex.EncodeToString(last[:])
+	}()
+
+	reader := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return report, err
+		}
+		if err == nil {
+			line = line[:len(line)-1]
+		}
+		isStart := err == nil && bytes.HasPrefix(line, []byte(LogChainPrefix+"start "))
+		if pendingSeparator > 0 && !isStart {
+			if !inChain {
+				return report, fmt.Errorf("line %d: not covered by a hash chain", pendingSeparator)
+			}
+			hash = chainLine(hash, separatorLine)
+			chainLines++
+		}
+		pendingSeparator = 0
+		if err == io.EOF {
+			if len(line) > 0 && inChain {
+				chainLines++ // not terminated, so not chained yet
+			}
+			break
+		}
+
+		switch {
+		case bytes.Equal(line, separatorLine):
+			pendingSeparator = lineNo
+		case isStart:
+			fields := recordFields(string(line[len(LogChainPrefix+"start "):]))
+			prev, ok := parseChainHash(fields["prev"])
+			if !ok {
+				return report, fmt.Errorf("line %d: malformed start record", lineNo)
+			}
+			if report.Chains == 0 {
+				report.File, report.Day, report.Prev = fields["file"], fields["day"], fields["prev"]
+				last = prev
+			}
+			switch {
+			case fields["file"] != report.File || fields["day"] != report.Day:
+				return report, fmt.Errorf("line %d: chain of another file %s of %s", lineNo, fields["file"], fields["day"])
+			case fields["seq"] != strconv.Itoa(report.Chains+1):
+				return report, fmt.Errorf("line %d: chain %s follows chain %d, chains were removed", lineNo, fields["seq"], report.Chains)
+			case prev != last:
+				return report, fmt.Errorf("line %d: chain does not continue the last checkpoint, the log was altered before it", lineNo)
+			}
+			endChain()
+			inChain = true
+			report.Chains++
+			hash = chainLine(prev, line)
+			chainLines = 1
+		case bytes.HasPrefix(line, []byte(LogChainPrefix+"checkpoint ")):
+			if !inChain {
+				return report, fmt.Errorf("line %d: checkpoint outside of a chain", lineNo)
+			}
+			expected := checkpointMessage(report.File, report.Day, chainLines, hash)
+			if err := verifyCheckpoint(string(line[len(LogChainPrefix+"checkpoint "):]), expected, publicKey); err != nil {
+				return report, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			report.Checkpoints++
+			chainSigned = chainLines
+			last = hash
+		case inChain:
+			hash = chainLine(hash, line)
+			chainLines++
+		default:
+			return report, fmt.Errorf("line %d: not covered by a hash chain", lineNo)
+		}
+	}
+	endChain()
+	return report, nil
+}
+
+// verifyCheckpoint verifies a checkpoint record "file=F day=D lines=N hash=H sig=S" against the expected message
+func verifyCheckpoint(record string, expected string, publicKey *[ed25519.PublicKeySize]byte) error {
+	n := strings.LastIndex(record, " sig=")
+	if n < 0 {
+		return fmt.Errorf("malformed checkpoint")
+	}
+	signed, rawSig := record[:n], record[n+len(" sig="):]
+	sig, err := base64.StdEncoding.DecodeString(rawSig)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(publicKey[:]), []byte(signed), sig) {
+		return fmt.Errorf("invalid checkpoint signature")
+	}
+	if signed != expected {
+		return fmt.Errorf("log altered before this checkpoint: signed %q, computed %q", signed, expected)
+	}
+	return nil
+}
+
+// VerifySignedLogFile verifies a signed log file, gzipped or not, see VerifySignedLog; the file must have the name it
+// was written with
+func VerifySignedLogFile(filename string, publicKey *[ed25519.PublicKeySize]byte) (SignedLogReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return SignedLogReport{}, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(filename, compressedSuffix) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return SignedLogReport{}, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	report, err := VerifySignedLog(r, publicKey)
+	if err == nil && report.Chains > 0 && report.File != strings.TrimSuffix(path.Base(filename), compressedSuffix) {
+		err = fmt.Errorf("signed for the file %s, renamed", report.File)
+	}
+	return report, err
+}
@@ -2,21 +2,28 @@ package logger
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 // FileWriter implements io.Writer and can be used with as a logger output to write logs to a log folder, in files named
-// according to the UTC day.
+// according to the UTC day. With FileWriterOptions, a day can be split into numbered segments by size, old files can be
+// removed and closed segments compressed.
 type FileWriter struct {
 	mux sync.Mutex
 
 	basePath string
 	prefix   string
 	suffix   string
+	opts     FileWriterOptions
 
 	lastLineRaw         []byte
 	lastLineCmp         []byte
@@ -25,12 +32,57 @@ type FileWriter struct {
 
 	lastLineSkipQ bool // if true the repeating lines will be merged
 
-	currentFile *os.File
+	currentFile    *os.File
+	currentDay     string
+	currentSegment int
+	currentSize    int64
+
+	chain *hashChain // signed mode, see FileWriterOptions.SigningKey
+
+	maintMux sync.Mutex // serializes compression and retention passes
+	maintWg  sync.WaitGroup
+}
+
+// FileWriterOptions configures rotation, retention and compression of a FileWriter. The zero value keeps the plain
+// behaviour: one file per UTC day, never deleted.
+type FileWriterOptions struct {
+	// MaxSize is the size in bytes after which the current file is closed and a new numbered segment
+	// (prefix+date+".N"+suffix) is started. 0 disables size-based rotation.
+	MaxSize int64
+
+	// MaxFiles is the number of log files (segments included) kept in basePath. 0 keeps all files. Only the files named
+	// like those of the writer count, and are deleted or compressed: basePath can be shared with other files, but not
+	// with another writer using the same prefix and suffix.
+	MaxFiles int
+
+	// MaxAge is the age after which log files are deleted. 0 keeps all files.
+	MaxAge time.Duration
+
+	// Compress gzips segments once they are closed (on size rotation or day change)
+	Compress bool
+
+	// SigningKey enables the signed mode, making the files tamper-evident: the lines are hash-chained, and checkpoints
+	// signed with this ed25519 private key (e.g. from utils.ReadPemPrivateKey) are written every CheckpointLines
+	// lines, after CheckpointInterval, and when a file is closed. See VerifySignedLog.
+	SigningKey *[64]byte
+
+	// CheckpointLines is the maximum number of lines between two checkpoints; LogCheckpointLines if 0
+	CheckpointLines int
+
+	// CheckpointInterval is the maximum time between two checkpoints, checked on write; LogCheckpointInterval if 0
+	CheckpointInterval time.Duration
 }
 
 // NewFileWriter creates a new file writer that writes to files in basePath
 // If prefix and/or suffix are set, they will be applied to the file names.
+// skipRepeating merges repeated lines of the simple format; the OutputDedup option of AddOutput does the same for
+// any format and output, and writes the summary without waiting for the next line.
 func NewFileWriter(basePath string, prefix, suffix *string, skipRepeating bool) (*FileWriter, error) {
+	return NewFileWriterEx(basePath, prefix, suffix, skipRepeating, FileWriterOptions{})
+}
+
+// NewFileWriterEx same as above, with rotation, retention and compression options
+func NewFileWriterEx(basePath string, prefix, suffix *string, skipRepeating bool, opts FileWriterOptions) (*FileWriter, error) {
 	var p, s string
 	if prefix != nil {
 		p = *prefix
@@ -50,16 +102,15 @@ func NewFileWriter(basePath string, prefix, suffix *string, skipRepeating bool)
 		}
 	}
 
-	return &FileWriter{basePath: basePath, prefix: p, suffix: s, lastLineSkipQ: skipRepeating}, nil
+	fw := &FileWriter{basePath: basePath, prefix: p, suffix: s, lastLineSkipQ: skipRepeating, opts: opts}
+	if opts.SigningKey != nil {
+		fw.chain = newHashChain(opts.SigningKey, opts)
+	}
+	return fw, nil
 }
 
 // Write implements io.Writer
 func (fw *FileWriter) Write(p []byte) (n int, err error) {
-	file, err := fw.getOrCreateFile(fw.getCurrentFileName())
-	if err != nil {
-		return 0, err
-	}
-
 	var line []byte
 	if fw.lastLineSkipQ {
 		// perform repeat check and line parsing
@@ -71,7 +122,38 @@ func (fw *FileWriter) Write(p []byte) (n int, err error) {
 	} else {
 		line = p
 	}
-	return file.Write(line)
+	return fw.writeLine(line)
+}
+
+// Close closes the current file and waits for pending compression and retention passes
+func (fw *FileWriter) Close() error {
+	fw.mux.Lock()
+	var err error
+	if fw.currentFile != nil {
+		fw.closeChain()
+		err = fw.currentFile.Close()
+		fw.currentFile = nil
+	}
+	fw.mux.Unlock()
+
+	fw.maintWg.Wait()
+	return err
+}
+
+func (fw *FileWriter) writeLine(line []byte) (int, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+
+	file, err := fw.getOrRotateFile(int64(len(line)))
+	if err != nil {
+		return 0, err
+	}
+	if fw.chain != nil {
+		return fw.writeChained(file, line)
+	}
+	n, err := file.Write(line)
+	fw.currentSize += int64(n)
+	return n, err
 }
 
 func (fw *FileWriter) updateLastLine(rawLine []byte) (skip bool, modifiedLine []byte) {
@@ -130,43 +212,293 @@ func (fw *FileWriter) updateLastLine(rawLine []byte) (skip bool, modifiedLine []
 	return false, []byte(l)
 }
 
-func (fw *FileWriter) getCurrentFileName() string {
-	return fmt.Sprintf("%s%s%s", fw.prefix, time.Now().UTC().Format("2006-01-02"), fw.suffix)
+// segmentFileName returns the name of a day's segment; segment 0 has no number
+func (fw *FileWriter) segmentFileName(day string, segment int) string {
+	if segment == 0 {
+		return fmt.Sprintf("%s%s%s", fw.prefix, day, fw.suffix)
+	}
+	return fmt.Sprintf("%s%s.%d%s", fw.prefix, day, segment, fw.suffix)
 }
 
-func (fw *FileWriter) getOrCreateFile(name string) (*os.File, error) {
-	fw.mux.Lock()
-	defer fw.mux.Unlock()
-
-	fullPath := path.Join(fw.basePath, name)
-	if fw.currentFile != nil {
-		if path.Clean(fw.currentFile.Name()) == path.Clean(fullPath) {
+// getOrRotateFile returns the file the next n bytes should be written to, switching to a new file on day change or
+// when MaxSize would be exceeded. Must be called with fw.mux held.
+func (fw *FileWriter) getOrRotateFile(n int64) (*os.File, error) {
+	day := time.Now().UTC().Format(fileDateFormat)
+	switch {
+	case fw.currentFile != nil && fw.currentDay == day:
+		if fw.opts.MaxSize <= 0 || fw.currentSize == 0 || fw.currentSize+n <= fw.opts.MaxSize {
 			return fw.currentFile, nil
 		}
+		fw.closeChain()
 		fw.currentFile.Close()
-		fw.currentFile = nil
+		fw.currentSegment++
+	default:
+		if fw.currentFile != nil {
+			fw.closeChain()
+			fw.currentFile.Close()
+		}
+		// continue with the last segment written today, e.g. after a restart
+		fw.currentSegment = fw.lastSegment(day)
 	}
+	fw.currentDay = day
+
+	file, size, err := fw.openFile(fw.segmentFileName(day, fw.currentSegment))
+	if err != nil {
+		return nil, err
+	}
+	fw.currentFile = file
+	fw.currentSize = size
+	fw.startMaintenance()
+	return file, nil
+}
+
+// openFile opens (or creates) a log file in append mode and returns its current size
+func (fw *FileWriter) openFile(name string) (*os.File, int64, error) {
+	fullPath := path.Join(fw.basePath, name)
 
 	// check if the file already exists; if so, we append a separator later
 	fileExists, err := exists(fullPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if file exists: %v", err)
+		return nil, 0, fmt.Errorf("failed to check if file exists: %v", err)
 	}
 
 	file, err := os.OpenFile(fullPath,
 		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	var size int64
 	// apply the separator if this is not a new file
 	if fileExists {
 		if _, err := file.WriteString(separator); err != nil {
-			return nil, fmt.Errorf("failed to write separator to existing file: %v", err)
+			return nil, 0, fmt.Errorf("failed to write separator to existing file: %v", err)
+		}
+		if st, err := file.Stat(); err == nil {
+			size = st.Size()
 		}
 	}
-	fw.currentFile = file
-	return file, nil
+	return file, size, nil
+}
+
+// lastSegment returns the highest segment number present for day. A compressed segment is closed, so the next number
+// is returned in that case.
+func (fw *FileWriter) lastSegment(day string) int {
+	last := 0
+	for _, lf := range fw.listLogFiles() {
+		if lf.day != day || lf.segment < last {
+			continue
+		}
+		last = lf.segment
+		if lf.compressed {
+			last++
+		}
+	}
+	return last
+}
+
+// logFileInfo describes a file in basePath that was written by this FileWriter
+type logFileInfo struct {
+	name       string
+	day        string
+	segment    int
+	compressed bool
+	modTime    time.Time
+}
+
+// listLogFiles returns the log files in basePath matching prefix+date[.N]+suffix[.gz], oldest first
+func (fw *FileWriter) listLogFiles() []logFileInfo {
+	entries, err := os.ReadDir(fw.basePath)
+	if err != nil {
+		return nil
+	}
+	var files []logFileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		lf, ok := fw.parseLogFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			lf.modTime = info.ModTime()
+		}
+		files = append(files, lf)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].before(files[j])
+	})
+	return files
+}
+
+// LogFile is a log file written by a FileWriter, see ListLogFiles
+type LogFile struct {
+	Path       string
+	Day        string // UTC day of the messages, "2006-01-02"
+	Segment    int    // 0 for the first segment of the day
+	Compressed bool
+}
+
+// ListLogFiles returns the log files written by a FileWriter with prefix and suffix in basePath, oldest first. A
+// segment being compressed is listed once, uncompressed.
+func ListLogFiles(basePath, prefix, suffix string) []LogFile {
+	fw := &FileWriter{basePath: basePath, prefix: prefix, suffix: suffix}
+	var files []LogFile
+	for _, lf := range fw.listLogFiles() {
+		if n := len(files); n > 0 && files[n-1].Day == lf.day && files[n-1].Segment == lf.segment {
+			if !lf.compressed {
+				files[n-1] = LogFile{Path: path.Join(basePath, lf.name), Day: lf.day, Segment: lf.segment}
+			}
+			continue
+		}
+		files = append(files, LogFile{Path: path.Join(basePath, lf.name), Day: lf.day, Segment: lf.segment, Compressed: lf.compressed})
+	}
+	return files
+}
+
+// Before reports whether lf was written before other
+func (lf LogFile) Before(other LogFile) bool {
+	return logFileInfo{day: lf.Day, segment: lf.Segment}.before(logFileInfo{day: other.Day, segment: other.Segment})
+}
+
+// IsFileWriterMarker reports whether line, without its newline, was written by a FileWriter itself rather than by a
+// logger: the separator written when a file is reopened, or a record of the signed mode
+func IsFileWriterMarker(line string) bool {
+	return line+"\n" == separator || strings.HasPrefix(line, LogChainPrefix)
+}
+
+// before reports whether lf was written before other
+func (lf logFileInfo) before(other logFileInfo) bool {
+	if lf.day != other.day {
+		return lf.day < other.day
+	}
+	return lf.segment < other.segment
+}
+
+// parseLogFileName parses the names written by the writer, prefix+date[.N]+suffix with an optional ".gz"; the other
+// files are never compressed nor removed
+func (fw *FileWriter) parseLogFileName(name string) (logFileInfo, bool) {
+	lf := logFileInfo{name: name}
+	if !strings.HasPrefix(name, fw.prefix) {
+		return lf, false
+	}
+	rest := name[len(fw.prefix):]
+	if len(rest) < len(fileDateFormat) {
+		return lf, false
+	}
+	lf.day, rest = rest[:len(fileDateFormat)], rest[len(fileDateFormat):]
+	if _, err := time.Parse(fileDateFormat, lf.day); err != nil {
+		return lf, false
+	}
+	if strings.HasSuffix(rest, compressedSuffix) {
+		lf.compressed = true
+		rest = strings.TrimSuffix(rest, compressedSuffix)
+	}
+	if !strings.HasSuffix(rest, fw.suffix) {
+		return lf, false
+	}
+	rest = rest[:len(rest)-len(fw.suffix)]
+	if rest == "" {
+		return lf, true
+	}
+	if rest[0] != '.' {
+		return lf, false
+	}
+	// only the segment numbers written by segmentFileName, e.g. not "007" or "+7"
+	segment, err := strconv.Atoi(rest[1:])
+	if err != nil || segment <= 0 || strconv.Itoa(segment) != rest[1:] {
+		return lf, false
+	}
+	lf.segment = segment
+	return lf, true
+}
+
+// startMaintenance compresses closed log files and applies the retention policy in the background
+func (fw *FileWriter) startMaintenance() {
+	if !fw.opts.Compress && fw.opts.MaxFiles <= 0 && fw.opts.MaxAge <= 0 {
+		return
+	}
+	fw.maintWg.Add(1)
+	go func() {
+		defer fw.maintWg.Done()
+		fw.maintMux.Lock()
+		defer fw.maintMux.Unlock()
+
+		// the file being written (and anything newer, should a rotation happen meanwhile) is left alone
+		fw.mux.Lock()
+		current := logFileInfo{day: fw.currentDay, segment: fw.currentSegment}
+		fw.mux.Unlock()
+
+		if fw.opts.Compress {
+			fw.compressClosedFiles(current)
+		}
+		fw.applyRetention(current)
+	}()
+}
+
+// compressClosedFiles gzips every uncompressed log file older than current
+func (fw *FileWriter) compressClosedFiles(current logFileInfo) {
+	for _, lf := range fw.listLogFiles() {
+		if lf.compressed || !lf.before(current) {
+			continue
+		}
+		if err := compressFile(path.Join(fw.basePath, lf.name)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compress log file %s: %v\n", lf.name, err)
+		}
+	}
+}
+
+// applyRetention deletes files beyond MaxFiles (oldest first) or older than MaxAge; current is always kept
+func (fw *FileWriter) applyRetention(current logFileInfo) {
+	if fw.opts.MaxFiles <= 0 && fw.opts.MaxAge <= 0 {
+		return
+	}
+	files := fw.listLogFiles()
+	now := time.Now()
+	for i, lf := range files {
+		if !lf.before(current) {
+			continue
+		}
+		tooMany := fw.opts.MaxFiles > 0 && len(files)-i > fw.opts.MaxFiles
+		tooOld := fw.opts.MaxAge > 0 && now.Sub(lf.modTime) > fw.opts.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(path.Join(fw.basePath, lf.name)); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "failed to remove old log file %s: %v\n", lf.name, err)
+			}
+		}
+	}
+}
+
+// compressFile gzips name into name+".gz" and removes the original
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpName := name + compressedSuffix + ".tmp"
+	dst, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, name+compressedSuffix); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
 }
 
 func exists(path string) (bool, error) {
@@ -181,3 +513,7 @@ func exists(path string) (bool, error) {
 }
 
 const separator = "======\n"
+
+const fileDateFormat = "2006-01-02"
+
+const compressedSuffix = ".gz"
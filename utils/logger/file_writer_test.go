@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriterSizeRotation(t *testing.T) {
+	dir := t.TempDir()
+	prefix, suffix := "app-", ".log"
+	fw, err := NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{MaxSize: 20, Compress: true})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := fw.Write([]byte("0123456789abcdef\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fw.Close())
+
+	day := time.Now().UTC().Format(fileDateFormat)
+	assert.FileExists(t, path.Join(dir, prefix+day+suffix+".gz"))
+	assert.FileExists(t, path.Join(dir, prefix+day+".1"+suffix+".gz"))
+	assert.FileExists(t, path.Join(dir, prefix+day+".2"+suffix))
+
+	// a restarted writer continues with the last open segment
+	fw, err = NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{MaxSize: 1000})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("after restart\n"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+
+	data, err := os.ReadFile(path.Join(dir, prefix+day+".2"+suffix))
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef\n"+separator+"after restart\n", string(data))
+}
+
+func TestFileWriterRetention(t *testing.T) {
+	dir := t.TempDir()
+	prefix, suffix := "", ".log"
+	old := time.Now().Add(-72 * time.Hour)
+	// files not named like those of the writer are left alone
+	others := []string{"unrelated.txt", "2020-01-01.007.log", "2020-01-01.+1.log", "2020-01-01.old.log", "app-2020-01-01.log",
+		"2020-01-01.log.bak", "2020-1-01.log"}
+	for _, name := range append([]string{"2020-01-01.log", "2020-01-02.log.gz", "2020-01-03.1.log"}, others...) {
+		require.NoError(t, os.WriteFile(path.Join(dir, name), []byte("x\n"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(dir, name), old, old))
+	}
+
+	fw, err := NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{MaxFiles: 2})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+
+	assert.NoFileExists(t, path.Join(dir, "2020-01-01.log"))
+	assert.NoFileExists(t, path.Join(dir, "2020-01-02.log.gz"))
+	assert.FileExists(t, path.Join(dir, "2020-01-03.1.log"))
+
+	fw, err = NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{MaxAge: 24 * time.Hour})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+
+	assert.NoFileExists(t, path.Join(dir, "2020-01-03.1.log"))
+
+	fw, err = NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{MaxFiles: 1, Compress: true})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+	for _, name := range others {
+		assert.FileExists(t, path.Join(dir, name))
+	}
+}
+
+func TestFileWriterSigned(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	var signingKey [64]byte
+	var verifyKey [32]byte
+	copy(signingKey[:], privateKey)
+	copy(verifyKey[:], publicKey)
+
+	dir := t.TempDir()
+	prefix, suffix := "trades-", ".log"
+	opts := FileWriterOptions{SigningKey: &signingKey, CheckpointLines: 3}
+	for run := 0; run < 2; run++ { // the second run appends a new chain
+		fw, err := NewFileWriterEx(dir, &prefix, &suffix, false, opts)
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			_, err := fw.Write([]byte(fmt.Sprintf("order %d filled\n", i)))
+			require.NoError(t, err)
+		}
+		_, err = fw.Write([]byte("multi\nline\n"))
+		require.NoError(t, err)
+		require.NoError(t, fw.Close())
+	}
+
+	filename := path.Join(dir, prefix+time.Now().UTC().Format(fileDateFormat)+suffix)
+	report, err := VerifySignedLogFile(filename, &verifyKey)
+	require.NoError(t, err)
+	name := prefix + time.Now().UTC().Format(fileDateFormat) + suffix
+	assert.Equal(t, SignedLogReport{Chains: 2, Checkpoints: 4, Lines: 14, Signed: 14, File: name,
+		Day: time.Now().UTC().Format(fileDateFormat), Prev: strings.Repeat("0", 64), Last: report.Last}, report)
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	verify := func(content string) (SignedLogReport, error) {
+		return VerifySignedLog(strings.NewReader(content), &verifyKey)
+	}
+
+	_, err = verify(strings.Replace(string(data), "order 1 filled", "order 1 cancelled", 1))
+	assert.ErrorContains(t, err, "log altered before this checkpoint")
+	_, err = verify(strings.Replace(string(data), "order 2 filled\n", "", 1))
+	assert.ErrorContains(t, err, "log altered before this checkpoint")
+	_, err = verify("forged line\n" + string(data))
+	assert.ErrorContains(t, err, "line 1: not covered by a hash chain")
+
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	copy(verifyKey[:], otherKey)
+	_, err = VerifySignedLogFile(filename, &verifyKey)
+	assert.ErrorContains(t, err, "invalid checkpoint signature")
+	copy(verifyKey[:], publicKey)
+
+	// lines after the last checkpoint can't be verified
+	report, err = verify(string(data) + "appended\n")
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Unsigned())
+
+	// the second chain continues the last checkpoint of the first one, written by another FileWriter
+	lines := strings.SplitAfter(string(data), "\n")
+	require.Len(t, lines, 20) // 14 lines, 4 checkpoints, a separator, and "" after the last newline
+	_, err = verify(strings.Join(lines[10:], ""))
+	assert.ErrorContains(t, err, "line 1: chain 2 follows chain 0, chains were removed")
+	// the last checkpoint of the first chain removed, and the lines after the previous one rewritten
+	forged := strings.Join(lines[:4], "") + "order 2 cancelled\n" + strings.Join(lines[9:], "")
+	_, err = verify(forged)
+	assert.ErrorContains(t, err, "line 7: chain does not continue the last checkpoint")
+
+	_, err = VerifySignedLog(strings.NewReader(string(data)), &verifyKey)
+	require.NoError(t, err)
+	renamed := path.Join(dir, prefix+"2000-01-01"+suffix)
+	require.NoError(t, os.Rename(filename, renamed))
+	_, err = VerifySignedLogFile(renamed, &verifyKey)
+	assert.ErrorContains(t, err, "signed for the file "+name+", renamed")
+}
+
+func TestFileWriterSignedSegments(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	var signingKey [64]byte
+	var verifyKey [32]byte
+	copy(signingKey[:], privateKey)
+	copy(verifyKey[:], publicKey)
+
+	dir := t.TempDir()
+	prefix, suffix := "", ".log"
+	fw, err := NewFileWriterEx(dir, &prefix, &suffix, false, FileWriterOptions{SigningKey: &signingKey, MaxSize: 180})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ { // one line per segment after the start record
+		_, err := fw.Write([]byte(fmt.Sprintf("order %d filled\n", i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fw.Close())
+
+	files := ListLogFiles(dir, prefix, suffix)
+	require.Len(t, files, 3)
+	var reports []SignedLogReport
+	for _, file := range files {
+		report, err := VerifySignedLogFile(file.Path, &verifyKey)
+		require.NoError(t, err)
+		assert.Zero(t, report.Unsigned())
+		reports = append(reports, report)
+	}
+	assert.True(t, reports[1].Continues(reports[0]))
+	assert.True(t, reports[2].Continues(reports[1]))
+	assert.False(t, reports[2].Continues(reports[0]), "a removed file breaks the link")
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatterOptions configures a formatter created by NewFormatterByName
+type FormatterOptions struct {
+	Ansi     bool   // expand ansi color codes (simple and template formats); stripped otherwise
+	TrailCR  bool   // append \n to each message (all formats but json)
+	Template string // template of the "template" format, see TemplateFormatter
+	Host     string // host of the "gelf" and syslog formats; defaults to the host name
+	AppName  string // application name of the syslog formats; defaults to the name of the executable
+	Facility int    // facility of the syslog formats, see ParseSyslogFacility
+
+	// Theme colors the level tags, namespaces and highlights of the simple format if Ansi is set, see Theme
+	Theme *Theme
+
+	// Time is the time format of the simple, json, logfmt and template formats; gelf and syslog times are fixed by
+	// their specifications
+	Time TimeFormat
+}
+
+// NewFormatterByName creates the formatter named "simple" (or ""), "json", "logfmt", "gelf", "template", or one of
+// the syslog formats "rfc5424" (or "syslog") and "rfc3164"
+func NewFormatterByName(name string, opts FormatterOptions) (Formatter, error) {
+	switch strings.ToLower(name) {
+	case "", "simple", "text":
+		return NewSimpleFormatterTheme(opts.Ansi, opts.TrailCR, opts.Time, opts.Theme)
+	case "json":
+		return NewJsonFormatterEx(opts.Time), nil
+	case "logfmt":
+		return NewLogfmtFormatterEx(opts.TrailCR, opts.Time), nil
+	case "gelf":
+		return NewGelfFormatter(opts.Host, opts.TrailCR), nil
+	case "rfc5424", "syslog":
+		return NewSyslogFormatter(SyslogRFC5424, opts.Facility, opts.Host, opts.AppName, opts.TrailCR), nil
+	case "rfc3164":
+		return NewSyslogFormatter(SyslogRFC3164, opts.Facility, opts.Host, opts.AppName, opts.TrailCR), nil
+	case "template":
+		if opts.Template == "" {
+			return nil, fmt.Errorf("empty log template")
+		}
+		return NewTemplateFormatterEx(opts.Template, opts.Ansi, opts.TrailCR, opts.Time)
+	}
+	return nil, fmt.Errorf("unknown log format %q", name)
+}
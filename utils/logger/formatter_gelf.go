@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GelfFormatter formats messages as GELF 1.1 JSON documents for Graylog. The namespace is sent as the "_namespace"
+// additional field, structured fields as "_<key>" additional fields.
+type GelfFormatter struct {
+	host    string
+	trailCR bool
+}
+
+type gelfLogMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+	Namespace    string  `json:"_namespace"`
+}
+
+func (f *GelfFormatter) String(lm logMessage) string {
+	level, hasLevel := syslogSeverities[lm.level]
+	if !hasLevel {
+		panic(fmt.Errorf("unknown log level: %v", lm.level))
+	}
+	message, _ := stripAnsi(lm.message)
+	var msg = gelfLogMessage{
+		Version:      "1.1",
+		Host:         f.host,
+		ShortMessage: message,
+		Timestamp:    float64(lm.unixTimestampNS/1e6) / 1e3,
+		Level:        level,
+		Namespace:    lm.namespace,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(fmt.Errorf("failed to marshal log message to GELF: %v", err))
+	}
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, field := range lm.fields {
+		keyData, _ := json.Marshal(gelfFieldKey(field.Key))
+		buf.WriteByte(',')
+		buf.Write(keyData)
+		buf.WriteByte(':')
+		buf.Write(marshalFieldValue(field.Value))
+	}
+	buf.WriteByte('}')
+	if f.trailCR {
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// gelfFieldKey returns the additional field name of a field key: prefixed with '_', with the characters not allowed
+// by GELF replaced with '_'. "_id" is reserved, and "_namespace" is used for the namespace, so they are renamed.
+func gelfFieldKey(key string) string {
+	key = "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, key)
+	if key == "_id" || key == "_namespace" {
+		key = "_fields." + key[1:]
+	}
+	return key
+}
+
+// NoDateNextLine is ignored
+func (f *GelfFormatter) NoDateNextLine() {
+}
+
+// NewLine is ignored
+func (f *GelfFormatter) NewLine() {
+}
+
+// NewGelfFormatter creates a GELF formatter; if host is empty, the host name of the machine is used
+func NewGelfFormatter(host string, trailCR bool) Formatter {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &GelfFormatter{host: host, trailCR: trailCR}
+}
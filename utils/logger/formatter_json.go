@@ -1,18 +1,24 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type JSONFormatter struct {
+	timeFormat TimeFormat // see NewJsonFormatterEx
 }
 
 type jsonLogMessage struct {
-	Severity  string `json:"severity"`
-	Time      int64  `json:"time"`
-	Namespace string `json:"context"`
-	Message   string `json:"message"`
+	Severity  string      `json:"severity"`
+	Time      interface{} `json:"time"` // nanoseconds since the epoch by default, see NewJsonFormatterEx
+	Namespace string      `json:"context"`
+	Message   string      `json:"message"`
+	Caller    string      `json:"caller,omitempty"`
+	Function  string      `json:"function,omitempty"`
+	Stack     string      `json:"stack,omitempty"`
 }
 
 // Implement the String method for JSONFormatter
@@ -23,16 +29,62 @@ func (f *JSONFormatter) String(lm logMessage) string {
 	}
 	var msg = jsonLogMessage{
 		Severity:  level,
-		Time:      lm.unixTimestampNS,
+		Time:      f.time(lm.unixTimestampNS),
 		Namespace: lm.namespace,
 		Message:   lm.message,
+		Caller:    lm.caller.String(),
+		Function:  lm.caller.Function,
+		Stack:     lm.stack,
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
 		panic(fmt.Errorf("failed to marshal log message to JSON: %v", err))
 	}
+	if len(lm.fields) == 0 {
+		return string(data)
+	}
+
+	// structured fields become top-level keys; keys clashing with the fixed ones are prefixed with "fields."
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, field := range lm.fields {
+		key := field.Key
+		if jsonReservedKeys[key] {
+			key = "fields." + key
+		}
+		keyData, _ := json.Marshal(key)
+		buf.WriteByte(',')
+		buf.Write(keyData)
+		buf.WriteByte(':')
+		buf.Write(marshalFieldValue(field.Value))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// time returns the JSON value of the time of a message: a number in the epoch mode, a string otherwise
+func (f *JSONFormatter) time(unixNanoseconds int64) interface{} {
+	switch {
+	case f.timeFormat.isDefault():
+		return unixNanoseconds
+	case f.timeFormat.Mode == TimeModeEpoch:
+		return f.timeFormat.epoch(unixNanoseconds)
+	}
+	return f.timeFormat.format(unixNanoseconds)
+}
 
-	return string(data)
+var jsonReservedKeys = map[string]bool{"severity": true, "time": true, "context": true, "message": true,
+	"caller": true, "function": true, "stack": true}
+
+// marshalFieldValue marshals a field value to JSON, falling back to its string representation
+func marshalFieldValue(v interface{}) []byte {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return data
 }
 
 // Implement the NoDateNextLine method for JSONFormatter
@@ -46,3 +98,12 @@ func (f *JSONFormatter) NewLine() {
 func NewJsonFormatter() Formatter {
 	return &JSONFormatter{}
 }
+
+// NewJsonFormatterEx same as above, with the time rendered according to timeFormat; the default mode is epoch in
+// nanoseconds
+func NewJsonFormatterEx(timeFormat TimeFormat) Formatter {
+	if timeFormat.isDefault() {
+		return NewJsonFormatter()
+	}
+	return &JSONFormatter{timeFormat: timeFormat.withDefaults(TimeModeEpoch, time.Nanosecond)}
+}
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogfmtFormatter formats messages as logfmt key=value pairs, e.g. for Loki:
+//
+//	time=2020-09-29T19:05:07.123Z level=info namespace=WS msg="order sent" orderId=42
+//
+// Structured fields follow the fixed keys; ansi color codes are stripped from the message.
+type LogfmtFormatter struct {
+	trailCR    bool
+	timeFormat TimeFormat // see NewLogfmtFormatterEx
+}
+
+// logfmtTimeFormat is RFC3339 with milliseconds
+const logfmtTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+var logfmtReservedKeys = map[string]bool{"time": true, "level": true, "namespace": true, "msg": true}
+
+func (f *LogfmtFormatter) String(lm logMessage) string {
+	level, hasLevel := logLevels[lm.level]
+	if !hasLevel {
+		panic(fmt.Errorf("unknown log level: %v", lm.level))
+	}
+	message, _ := stripAnsi(lm.message)
+
+	var sb strings.Builder
+	sb.WriteString("time=")
+	if f.timeFormat.isDefault() {
+		sb.WriteString(time.Unix(0, lm.unixTimestampNS).UTC().Format(logfmtTimeFormat))
+	} else {
+		sb.WriteString(formatFieldValue(f.timeFormat.format(lm.unixTimestampNS)))
+	}
+	sb.WriteString(" level=")
+	sb.WriteString(strings.ToLower(level))
+	sb.WriteString(" namespace=")
+	sb.WriteString(formatFieldValue(lm.namespace))
+	sb.WriteString(" msg=")
+	sb.WriteString(formatFieldValue(message))
+	for _, field := range lm.fields {
+		key := logfmtKey(field.Key)
+		if logfmtReservedKeys[key] {
+			key = "fields." + key
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(formatFieldValue(field.Value))
+	}
+	if f.trailCR {
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// logfmtKey replaces the characters not allowed in a logfmt key with '_'
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// NoDateNextLine is ignored: every line carries all the keys
+func (f *LogfmtFormatter) NoDateNextLine() {
+}
+
+// NewLine is ignored
+func (f *LogfmtFormatter) NewLine() {
+}
+
+func NewLogfmtFormatter(trailCR bool) Formatter {
+	return &LogfmtFormatter{trailCR: trailCR}
+}
+
+// NewLogfmtFormatterEx same as above, with the time rendered according to timeFormat; the default mode is RFC3339
+func NewLogfmtFormatterEx(trailCR bool, timeFormat TimeFormat) Formatter {
+	f := &LogfmtFormatter{trailCR: trailCR}
+	if !timeFormat.isDefault() {
+		f.timeFormat = timeFormat.withDefaults(TimeModeRFC3339, time.Millisecond)
+	}
+	return f
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/mgutz/ansi"
 	"sync/atomic"
+	"time"
 )
 
 type SimpleFormatter struct {
@@ -12,6 +13,9 @@ type SimpleFormatter struct {
 	trailCR   bool   // automatically append \n to the string
 	ansiReset string // code for resetting ansi
 	ansi      bool
+
+	timeFormat TimeFormat   // see NewSimpleFormatterEx
+	theme      atomic.Value // *themeCodes, see SetTheme
 }
 
 func (f *SimpleFormatter) String(lm logMessage) string {
@@ -24,11 +28,21 @@ func (f *SimpleFormatter) String(lm logMessage) string {
 		cr = "\n"
 	}
 
+	var stack string
+	if lm.stack != "" {
+		stack = "\n" + lm.stack
+	}
+
+	namespace, body := lm.namespace, lm.message+formatFieldsKV(lm.fields)
+	if theme, _ := f.theme.Load().(*themeCodes); theme != nil && f.ansi {
+		level, namespace, body = theme.level(lm.level, level), theme.namespace(namespace), theme.highlight(body)
+	}
+
 	var txt = ""
 	if f.skipDate == 0 {
-		txt = fmt.Sprintf("%s (%s) [%s]: %s%s", formatTime(lm.unixTimestampNS), lm.namespace, level, lm.message, cr)
+		txt = fmt.Sprintf("%s (%s) [%s]%s: %s%s%s", f.formatTime(lm.unixTimestampNS), namespace, level, formatCaller(lm.caller), body, stack, cr)
 	} else {
-		txt = fmt.Sprintf("%s\n", lm.message)
+		txt = fmt.Sprintf("%s%s\n", body, stack)
 	}
 
 	if f.ansi {
@@ -47,6 +61,33 @@ func (f *SimpleFormatter) String(lm logMessage) string {
 	return txt
 }
 
+func (f *SimpleFormatter) formatTime(unixNanoseconds int64) string {
+	if f.timeFormat.isDefault() {
+		return formatTime(unixNanoseconds)
+	}
+	return f.timeFormat.format(unixNanoseconds)
+}
+
+// formatCaller renders the caller as " <file:line function>", or "" if unknown
+func formatCaller(c Caller) string {
+	if c.File == "" {
+		return ""
+	}
+	return " <" + c.String() + " " + c.Function + ">"
+}
+
+// SetTheme colors the level tags, namespaces and highlights of the messages according to theme if the formatter has
+// ansi support; nil removes the theme. Returns an error if a color of theme is invalid, see Theme.Validate.
+func (f *SimpleFormatter) SetTheme(theme *Theme) error {
+	if theme != nil {
+		if err := theme.Validate(); err != nil {
+			return err
+		}
+	}
+	f.theme.Store(theme.compile())
+	return nil
+}
+
 // NoDateNextLine starts next line without date/debug/servie label
 func (f *SimpleFormatter) NoDateNextLine() {
 	atomic.StoreInt32(&f.skipDate, 1)
@@ -59,10 +100,26 @@ func (f *SimpleFormatter) NewLine() {
 
 func NewSimpleFormatter(ansiSupport bool, trailCR bool) Formatter {
 	return &SimpleFormatter{
-		0,
-		0,
-		trailCR,
-		ansi.ColorCode("reset"),
-		ansiSupport,
+		trailCR:   trailCR,
+		ansiReset: ansi.ColorCode("reset"),
+		ansi:      ansiSupport,
+	}
+}
+
+// NewSimpleFormatterEx same as above, with the time rendered according to timeFormat
+func NewSimpleFormatterEx(ansiSupport bool, trailCR bool, timeFormat TimeFormat) Formatter {
+	f := NewSimpleFormatter(ansiSupport, trailCR).(*SimpleFormatter)
+	if !timeFormat.isDefault() {
+		f.timeFormat = timeFormat.withDefaults(TimeModeSimple, time.Millisecond)
+	}
+	return f
+}
+
+// NewSimpleFormatterTheme same as NewSimpleFormatterEx, with the messages colored according to theme, see SetTheme
+func NewSimpleFormatterTheme(ansiSupport bool, trailCR bool, timeFormat TimeFormat, theme *Theme) (Formatter, error) {
+	f := NewSimpleFormatterEx(ansiSupport, trailCR, timeFormat).(*SimpleFormatter)
+	if err := f.SetTheme(theme); err != nil {
+		return nil, err
 	}
+	return f, nil
 }
@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogFormat is the message format of a SyslogFormatter
+type SyslogFormat int
+
+const (
+	// SyslogRFC5424 is the current syslog protocol format; structured fields are sent as structured data
+	SyslogRFC5424 SyslogFormat = iota
+
+	// SyslogRFC3164 is the legacy BSD syslog format; structured fields are appended to the message as key=value
+	SyslogRFC3164
+)
+
+// SyslogStructuredDataID is the SD-ID of the structured data element holding the fields in RFC 5424 messages
+var SyslogStructuredDataID = "fields@32473"
+
+// syslogSeverities are the syslog severities of the log levels, also used by GELF
+var syslogSeverities = map[LogLevel]int{
+	LogLevelDebug: 7,
+	LogLevelInfo:  6,
+	LogLevelWarn:  4,
+	LogLevelError: 3,
+	LogLevelFatal: 2,
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseSyslogFacility parses a facility name like "local0" or "daemon", or a facility number
+func ParseSyslogFacility(raw string) (int, error) {
+	if facility, ok := syslogFacilities[strings.ToLower(raw)]; ok {
+		return facility, nil
+	}
+	if facility, err := strconv.Atoi(raw); err == nil && facility >= 0 && facility < 24 {
+		return facility, nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility %q", raw)
+}
+
+// SyslogFormatter formats messages as syslog messages, including the PRI header, to be sent by a SyslogWriter. The
+// namespace is the MSGID of RFC 5424 messages, and prefixes the message in RFC 3164 messages.
+type SyslogFormatter struct {
+	format   SyslogFormat
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	trailCR  bool
+}
+
+func (f *SyslogFormatter) String(lm logMessage) string {
+	severity, hasLevel := syslogSeverities[lm.level]
+	if !hasLevel {
+		panic(fmt.Errorf("unknown log level: %v", lm.level))
+	}
+	message, _ := stripAnsi(lm.message)
+	t := time.Unix(0, lm.unixTimestampNS).UTC()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<%d>", f.facility*8+severity)
+	if f.format == SyslogRFC3164 {
+		fmt.Fprintf(&sb, "%s %s %s[%s]: (%s) %s%s", t.Format(time.Stamp), f.hostname, f.appName, f.procID,
+			lm.namespace, message, formatFieldsKV(lm.fields))
+	} else {
+		fmt.Fprintf(&sb, "1 %s %s %s %s %s %s %s", t.Format("2006-01-02T15:04:05.000000Z07:00"), f.hostname, f.appName,
+			f.procID, syslogName(lm.namespace, 32), syslogStructuredData(lm.fields), message)
+	}
+	if f.trailCR {
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// syslogName returns s restricted to printable ASCII without spaces and truncated to maxLen, or "-" if empty
+func syslogName(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogStructuredData renders fields as an RFC 5424 structured data element, or "-" if there are none
+func syslogStructuredData(fields []Field) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	var sb strings.Builder
+	sb.WriteByte('[')
+	sb.WriteString(SyslogStructuredDataID)
+	for _, field := range fields {
+		name := strings.Map(func(r rune) rune {
+			if r == '=' || r == ']' || r == '"' {
+				return '_'
+			}
+			return r
+		}, field.Key)
+		fmt.Fprintf(&sb, ` %s="%s"`, syslogName(name, 32), sdValueEscaper.Replace(fmt.Sprint(field.Value)))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// NoDateNextLine is ignored
+func (f *SyslogFormatter) NoDateNextLine() {
+}
+
+// NewLine is ignored
+func (f *SyslogFormatter) NewLine() {
+}
+
+// NewSyslogFormatter creates a syslog formatter. If hostname or appName are empty, the host name of the machine and
+// the name of the executable are used.
+func NewSyslogFormatter(format SyslogFormat, facility int, hostname, appName string, trailCR bool) Formatter {
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	return &SyslogFormatter{
+		format:   format,
+		facility: facility,
+		hostname: syslogName(hostname, 255),
+		appName:  syslogName(appName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+		trailCR:  trailCR,
+	}
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mgutz/ansi"
+)
+
+// TemplateFormatter formats messages with a user-defined text/template executed over a TemplateRecord, e.g.
+//
+//	{{.Timestamp}} {{.Level | printf "%-5s"}} {{.Namespace}}: {{.Message}}{{range .Fields}} {{.Key}}={{.Value}}{{end}}
+//
+// Besides the text/template builtins, the template can use the functions lower, upper, fields (renders the fields
+// as key=value pairs), field (value of a field by key, or nil) and json (JSON encoding of a value).
+type TemplateFormatter struct {
+	tmpl      *template.Template
+	trailCR   bool
+	ansi      bool
+	ansiReset string
+
+	timeFormat TimeFormat // see NewTemplateFormatterEx
+}
+
+// TemplateRecord is the data a TemplateFormatter template is executed over
+type TemplateRecord struct {
+	Level     string // DEBUG, INFO, WARN, ERROR or FATAL
+	Namespace string
+	Time      time.Time // UTC, or the location of the time format
+	Timestamp string    // Time in the format of SimpleFormatter (2020-10-15 10:28:21.333), or the time format
+	Message   string
+	Fields    []Field // structured fields, in order
+	Caller    Caller  // source location, if the output asks for it, see SourceInfo
+	Stack     string  // stack of ERROR and FATAL messages, if the output asks for it
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"fields": func(fields []Field) string {
+		return strings.TrimPrefix(formatFieldsKV(fields), " ")
+	},
+	"field": func(key string, fields []Field) interface{} {
+		for _, f := range fields {
+			if f.Key == key {
+				return f.Value
+			}
+		}
+		return nil
+	},
+	"json": func(v interface{}) string {
+		return string(marshalFieldValue(v))
+	},
+}
+
+func (f *TemplateFormatter) String(lm logMessage) string {
+	level, hasLevel := logLevels[lm.level]
+	if !hasLevel {
+		panic(fmt.Errorf("unknown log level: %v", lm.level))
+	}
+	record := TemplateRecord{
+		Level:     level,
+		Namespace: lm.namespace,
+		Time:      time.Unix(0, lm.unixTimestampNS).UTC(),
+		Timestamp: formatTime(lm.unixTimestampNS),
+		Message:   lm.message,
+		Fields:    lm.fields,
+		Caller:    lm.caller,
+		Stack:     lm.stack,
+	}
+	if !f.timeFormat.isDefault() {
+		record.Time = record.Time.In(f.timeFormat.Location)
+		record.Timestamp = f.timeFormat.format(lm.unixTimestampNS)
+	}
+
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, record); err != nil {
+		buf.Reset()
+		fmt.Fprintf(&buf, "%s (%s) [%s]: %s%s (log template error: %v)",
+			record.Timestamp, lm.namespace, level, lm.message, formatFieldsKV(lm.fields), err)
+	}
+	if f.trailCR {
+		buf.WriteByte('\n')
+	}
+
+	txt := buf.String()
+	if f.ansi {
+		var mod bool
+		if txt, mod = expandAnsi(txt); mod {
+			txt += f.ansiReset
+		}
+	} else {
+		txt, _ = stripAnsi(txt)
+	}
+	return txt
+}
+
+// NoDateNextLine is ignored: the template decides what each line contains
+func (f *TemplateFormatter) NoDateNextLine() {
+}
+
+// NewLine is ignored
+func (f *TemplateFormatter) NewLine() {
+}
+
+// NewTemplateFormatter parses text as a TemplateFormatter template
+func NewTemplateFormatter(text string, ansiSupport bool, trailCR bool) (Formatter, error) {
+	tmpl, err := template.New("log").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log template: %v", err)
+	}
+	return &TemplateFormatter{tmpl: tmpl, trailCR: trailCR, ansi: ansiSupport, ansiReset: ansi.ColorCode("reset")}, nil
+}
+
+// NewTemplateFormatterEx same as above, with the Timestamp of the records rendered according to timeFormat
+func NewTemplateFormatterEx(text string, ansiSupport bool, trailCR bool, timeFormat TimeFormat) (Formatter, error) {
+	f, err := NewTemplateFormatter(text, ansiSupport, trailCR)
+	if err != nil || timeFormat.isDefault() {
+		return f, err
+	}
+	f.(*TemplateFormatter).timeFormat = timeFormat.withDefaults(TimeModeSimple, time.Millisecond)
+	return f, nil
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -66,3 +67,148 @@ func TestNewJsonFormatter(t *testing.T) {
 	f := NewJsonFormatter()
 	assert.IsType(t, &JSONFormatter{}, f)
 }
+
+func TestJSONFormatter_Fields(t *testing.T) {
+	f := &JSONFormatter{}
+	lm := logMessage{
+		level:           LogLevelInfo,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "order sent",
+		fields:          []Field{F("orderId", "abc-1"), F("qty", 2.5), F("message", "dup")},
+	}
+	expected := `{"severity":"INFO","time":1612345678901234567,"context":"app","message":"order sent","orderId":"abc-1","qty":2.5,"fields.message":"dup"}`
+	assert.Equal(t, expected, f.String(lm))
+}
+
+func TestSimpleFormatter_Fields(t *testing.T) {
+	f := NewSimpleFormatter(false, true)
+	lm := logMessage{
+		level:           LogLevelInfo,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "order sent",
+		fields:          []Field{F("orderId", "abc-1"), F("symbol", "BTC USD"), F("latency", 1500)},
+	}
+	expected := "2021-02-03 09:47:58.901 (app) [INFO]: order sent orderId=abc-1 symbol=\"BTC USD\" latency=1500\n"
+	assert.Equal(t, expected, f.String(lm))
+}
+
+func TestLogfmtFormatter_String(t *testing.T) {
+	f := NewLogfmtFormatter(true)
+	lm := logMessage{
+		level:           LogLevelWarn,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "{red}order rejected{reset}",
+		fields:          []Field{F("orderId", 42), F("reason", "no funds"), F("msg", "dup"), F("bad key", 1)},
+	}
+	expected := `time=2021-02-03T09:47:58.901Z level=warn namespace=app msg="order rejected" orderId=42 reason="no funds" fields.msg=dup bad_key=1` + "\n"
+	assert.Equal(t, expected, f.String(lm))
+}
+
+func TestGelfFormatter_String(t *testing.T) {
+	f := NewGelfFormatter("host1", false)
+	lm := logMessage{
+		level:           LogLevelError,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "order rejected",
+		fields:          []Field{F("orderId", 42), F("id", "x"), F("user name", "bob")},
+	}
+	expected := `{"version":"1.1","host":"host1","short_message":"order rejected","timestamp":1612345678.901,"level":3,"_namespace":"app","_orderId":42,"_fields.id":"x","_user_name":"bob"}`
+	assert.Equal(t, expected, f.String(lm))
+}
+
+func TestTemplateFormatter_String(t *testing.T) {
+	f, err := NewTemplateFormatter(`{{.Timestamp}} {{.Level | lower}} {{.Namespace}}: {{.Message}} [{{fields .Fields}}] side={{field "side" .Fields}}`, false, true)
+	assert.NoError(t, err)
+	lm := logMessage{
+		level:           LogLevelInfo,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "order sent",
+		fields:          []Field{F("orderId", 42), F("side", "buy")},
+	}
+	expected := "2021-02-03 09:47:58.901 info app: order sent [orderId=42 side=buy] side=buy\n"
+	assert.Equal(t, expected, f.String(lm))
+
+	_, err = NewTemplateFormatter(`{{.Message`, false, true)
+	assert.Error(t, err)
+
+	// execution errors fall back to the simple format
+	f, err = NewTemplateFormatter(`{{.Missing}}`, false, false)
+	assert.NoError(t, err)
+	assert.Contains(t, f.String(lm), "2021-02-03 09:47:58.901 (app) [INFO]: order sent orderId=42 side=buy (log template error:")
+}
+
+func TestNewFormatterByName(t *testing.T) {
+	for name, expected := range map[string]Formatter{
+		"":       &SimpleFormatter{},
+		"simple": &SimpleFormatter{},
+		"JSON":   &JSONFormatter{},
+		"logfmt": &LogfmtFormatter{},
+		"gelf":   &GelfFormatter{},
+	} {
+		f, err := NewFormatterByName(name, FormatterOptions{})
+		assert.NoError(t, err)
+		assert.IsType(t, expected, f)
+	}
+
+	f, err := NewFormatterByName("template", FormatterOptions{Template: "{{.Message}}"})
+	assert.NoError(t, err)
+	assert.IsType(t, &TemplateFormatter{}, f)
+
+	_, err = NewFormatterByName("template", FormatterOptions{})
+	assert.Error(t, err)
+	_, err = NewFormatterByName("xml", FormatterOptions{})
+	assert.Error(t, err)
+}
+
+func TestTimeFormat(t *testing.T) {
+	lm := logMessage{
+		level:           LogLevelInfo,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "app",
+		message:         "order sent",
+	}
+
+	tokyo, err := ParseTimeFormat("", "us", "Asia/Tokyo")
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-02-03 18:47:58.901234+09:00 (app) [INFO]: order sent", NewSimpleFormatterEx(false, false, tokyo).String(lm))
+
+	rfc3339, err := ParseTimeFormat("rfc3339", "ns", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-02-03T09:47:58.901234567Z (app) [INFO]: order sent", NewSimpleFormatterEx(false, false, rfc3339).String(lm))
+	assert.Equal(t, `{"severity":"INFO","time":"2021-02-03T09:47:58.901234567Z","context":"app","message":"order sent"}`,
+		NewJsonFormatterEx(rfc3339).String(lm))
+
+	epoch, err := ParseTimeFormat("epoch", "ms", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"severity":"INFO","time":1612345678901,"context":"app","message":"order sent"}`, NewJsonFormatterEx(epoch).String(lm))
+	assert.Equal(t, `time=1612345678901 level=info namespace=app msg="order sent"`, NewLogfmtFormatterEx(false, epoch).String(lm))
+	assert.Equal(t, `{"severity":"INFO","time":1612345678901234567,"context":"app","message":"order sent"}`,
+		NewJsonFormatterEx(TimeFormat{}).String(lm))
+	assert.Equal(t, `time=2021-02-03T18:47:58.901234+09:00 level=info namespace=app msg="order sent"`, NewLogfmtFormatterEx(false, tokyo).String(lm))
+
+	layout, err := ParseTimeFormat("15:04:05", "", "")
+	assert.NoError(t, err)
+	f, err := NewTemplateFormatterEx("{{.Timestamp}} {{.Message}}", false, false, layout)
+	assert.NoError(t, err)
+	assert.Equal(t, "09:47:58 order sent", f.String(lm))
+
+	for _, args := range [][3]string{{"iso", "", ""}, {"", "ps", ""}, {"", "", "Mars/Olympus"}} {
+		_, err = ParseTimeFormat(args[0], args[1], args[2])
+		assert.Error(t, err, args)
+	}
+
+	// the times are parsed back whatever the precision, mode and zone
+	simple, err := ParseTimeFormat("simple", "ms", "")
+	assert.NoError(t, err)
+	for _, f := range []Formatter{NewSimpleFormatterEx(false, false, rfc3339), NewSimpleFormatterEx(false, false, tokyo),
+		NewSimpleFormatterEx(false, false, simple), NewJsonFormatterEx(epoch), NewLogfmtFormatterEx(false, tokyo)} {
+		rec, err := ParseLogLine(f.String(lm))
+		assert.NoError(t, err)
+		assert.Equal(t, time.Unix(0, lm.unixTimestampNS).Truncate(time.Millisecond).UTC(), rec.Time.Truncate(time.Millisecond), f.String(lm))
+	}
+}
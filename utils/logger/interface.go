@@ -42,10 +42,35 @@ type Logger interface {
 	// Fatalf logs formatted arguments with log level CRITICAL
 	Fatalf(namespace, format string, a ...interface{})
 
-	// AddOutput adds a log output that receives messages where level is >= minlevel and the namespace matches filter
-	AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, opts ...interface{})
+	// Debugw logs a message with log level DEBUG and structured key/value pairs
+	Debugw(namespace, msg string, keysAndValues ...interface{})
 
-	// Flush flushes the logger and clears any pending messages
+	// Infow logs a message with log level INFO and structured key/value pairs
+	Infow(namespace, msg string, keysAndValues ...interface{})
+
+	// Warnw logs a message with log level WARNING and structured key/value pairs
+	Warnw(namespace, msg string, keysAndValues ...interface{})
+
+	// Errorw logs a message with log level ERROR and structured key/value pairs
+	Errorw(namespace, msg string, keysAndValues ...interface{})
+
+	// Fatalw logs a message with log level CRITICAL and structured key/value pairs
+	Fatalw(namespace, msg string, keysAndValues ...interface{})
+
+	// With returns a child logger that attaches the given key/value pairs (or Fields) to every message it logs
+	With(keysAndValues ...interface{}) Logger
+
+	// Named returns a child logger logging under the dotted namespace name, relative to the namespace of the logger:
+	// lgr.Named("exch").Named("binance").Infof("ws", ...) logs in "exch.binance.ws", and an empty namespace (or "*")
+	// logs in "exch.binance" itself. See JoinNamespace and SetNamespaceLevels.
+	Named(name string) Logger
+
+	// AddOutput adds a log output that receives messages where level is >= minlevel and the namespace matches filter.
+	// The returned handle allows changing the level and filter of the output at runtime, or removing it.
+	AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, opts ...interface{}) OutputHandle
+
+	// Flush flushes the logger and clears any pending messages. It must not be called from the writer of an output,
+	// or from an error hook run there, as it would wait for itself.
 	Flush()
 
 	// NewLine inserts \n before next output
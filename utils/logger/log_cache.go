@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// logCache is a fixed-size ring buffer of the most recent formatted log lines. A nil cache ignores everything.
+type logCache struct {
+	mux   sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newLogCache(size int) *logCache {
+	if size <= 0 {
+		return nil
+	}
+	return &logCache{lines: make([]string, size)}
+}
+
+func (lc *logCache) add(line string) {
+	if lc == nil {
+		return
+	}
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+
+	lc.lines[lc.next] = line
+	lc.next++
+	if lc.next == len(lc.lines) {
+		lc.next = 0
+		lc.full = true
+	}
+}
+
+// snapshot returns the cached lines, oldest first
+func (lc *logCache) snapshot() []string {
+	if lc == nil {
+		return nil
+	}
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+
+	if !lc.full {
+		return append([]string(nil), lc.lines[:lc.next]...)
+	}
+	res := make([]string, 0, len(lc.lines))
+	res = append(res, lc.lines[lc.next:]...)
+	return append(res, lc.lines[:lc.next]...)
+}
+
+// DumpCache writes the recent log lines retained by the logger (see LogCacheSize) to dst, oldest first. Pending logs
+// are flushed first, so the dump includes everything logged before the call.
+func (lgr *AsyncLogger) DumpCache(dst io.Writer) error {
+	lgr.Flush()
+	return lgr.writeCache(dst)
+}
+
+func (lgr *AsyncLogger) writeCache(dst io.Writer) error {
+	lines := lgr.cache.snapshot()
+	if _, err := fmt.Fprintf(dst, "====== log cache dump: last %d lines ======\n", len(lines)); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(dst, line); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(dst, "====== end of log cache dump ======\n")
+	return err
+}
+
+// DumpCacheToFile appends the recent log lines retained by the logger to the file at filename
+func (lgr *AsyncLogger) DumpCacheToFile(filename string) error {
+	lgr.Flush()
+	return lgr.writeCacheToFile(filename, "")
+}
+
+// writeCacheToFile appends the cache to the file at filename, after the reason of the dump if not empty
+func (lgr *AsyncLogger) writeCacheToFile(filename, reason string) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log cache dump file: %v", err)
+	}
+	defer file.Close()
+	if reason != "" {
+		if _, err = fmt.Fprintf(file, "%s\n", reason); err != nil {
+			return err
+		}
+	}
+	return lgr.writeCache(file)
+}
+
+// SetCacheDumpFile sets the file the log cache is dumped to on Fatalf or a panic caught by DumpOnPanic, after the
+// FATAL message or the panic value.
+// If not set (or set to ""), the cache is dumped to stderr.
+func (lgr *AsyncLogger) SetCacheDumpFile(filename string) {
+	lgr.cacheMux.Lock()
+	defer lgr.cacheMux.Unlock()
+	lgr.cacheDumpFile = filename
+}
+
+// CacheDumpFile returns the file set with SetCacheDumpFile, or "" if none
+func (lgr *AsyncLogger) CacheDumpFile() string {
+	lgr.cacheMux.Lock()
+	defer lgr.cacheMux.Unlock()
+	return lgr.cacheDumpFile
+}
+
+// DumpOnPanic dumps the log cache if the calling goroutine is panicking, then resumes the panic.
+// It must be deferred directly:
+//
+//	defer lgr.DumpOnPanic()
+func (lgr *AsyncLogger) DumpOnPanic() {
+	if r := recover(); r != nil {
+		lgr.Flush()
+		lgr.autoDumpCache(fmt.Sprintf("panic: %v", r))
+		panic(r)
+	}
+}
+
+// autoDumpCache dumps the cache to the configured dump file, or stderr. Pending logs are not flushed, so this can be
+// called from the writer goroutine.
+func (lgr *AsyncLogger) autoDumpCache(reason string) {
+	if lgr.cache == nil {
+		return
+	}
+	if filename := lgr.CacheDumpFile(); filename != "" {
+		err := lgr.writeCacheToFile(filename, reason)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "%s; log cache dumped to %s\n", reason, filename)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "failed to dump log cache to %s: %v\n", filename, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", reason)
+	_ = lgr.writeCache(os.Stderr)
+}
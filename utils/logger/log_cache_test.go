@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncLoggerDumpCache(t *testing.T) {
+	// stub the clock
+	currentTime, _ := time.Parse(time.RFC3339Nano, "2020-09-29T19:05:07.123456Z")
+	currentClock = testClock(currentTime)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	var capturedOutput bytes.Buffer
+	testLogger := &AsyncLogger{
+		logs:           make(chan logMessage),
+		cache:          newLogCache(2),
+		cacheFormatter: NewSimpleFormatter(false, true),
+		outputs: []*logOutput{{
+			dst:       &capturedOutput,
+			minLevel:  LogLevelWarn,
+			filter:    FilterMatchAll,
+			formatter: NewSimpleFormatter(false, true),
+		}},
+	}
+	go testLogger.handleLogs(ctx)
+
+	testLogger.Debugf("test-logger", "dropped from the cache")
+	testLogger.Debugf("test-logger", "only in the cache")
+	testLogger.Warnf("test-logger", "everywhere")
+
+	testLogger.Flush()
+
+	var dump bytes.Buffer
+	assert.NoError(t, testLogger.DumpCache(&dump))
+
+	expectedDump := "====== log cache dump: last 2 lines ======\n" +
+		"2020-09-29 19:05:07.123 (test-logger) [DEBUG]: only in the cache\n" +
+		"2020-09-29 19:05:07.123 (test-logger) [WARN]: everywhere\n" +
+		"====== end of log cache dump ======\n"
+	assert.Equal(t, expectedDump, dump.String())
+	assert.Equal(t, "2020-09-29 19:05:07.123 (test-logger) [WARN]: everywhere\n", capturedOutput.String())
+}
+
+func TestAsyncLoggerDumpOnPanic(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{
+		logs:           make(chan logMessage),
+		cache:          newLogCache(10),
+		cacheFormatter: NewSimpleFormatter(false, true),
+	}
+	go testLogger.handleLogs(ctx)
+
+	dumpFile := t.TempDir() + "/dump.log"
+	testLogger.SetCacheDumpFile(dumpFile)
+	testLogger.Infof("test-logger", "lead-up")
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer testLogger.DumpOnPanic()
+		panic("boom")
+	})
+	dump, err := os.ReadFile(dumpFile)
+	require.NoError(t, err)
+	lines := strings.Split(string(dump), "\n")
+	require.GreaterOrEqual(t, len(lines), 4)
+	assert.Equal(t, "panic: boom", lines[0])
+	assert.Equal(t, "====== log cache dump: last 1 lines ======", lines[1])
+	assert.Contains(t, lines[2], "(test-logger) [INFO]: lead-up")
+	assert.Equal(t, "====== end of log cache dump ======", lines[3])
+}
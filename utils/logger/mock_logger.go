@@ -35,13 +35,15 @@ func (m *MockLogger) EXPECT() *MockLoggerMockRecorder {
 }
 
 // AddOutput mocks base method.
-func (m *MockLogger) AddOutput(arg0 FilterFunc, arg1 io.Writer, arg2 LogLevel, arg3, arg4 bool, arg5 ...interface{}) {
+func (m *MockLogger) AddOutput(arg0 FilterFunc, arg1 io.Writer, arg2 LogLevel, arg3, arg4 bool, arg5 ...interface{}) OutputHandle {
 	m.ctrl.T.Helper()
 	varargs := []interface{}{arg0, arg1, arg2, arg3, arg4}
 	for _, a := range arg5 {
 		varargs = append(varargs, a)
 	}
-	m.ctrl.Call(m, "AddOutput", varargs...)
+	ret := m.ctrl.Call(m, "AddOutput", varargs...)
+	ret0, _ := ret[0].(OutputHandle)
+	return ret0
 }
 
 // AddOutput indicates an expected call of AddOutput.
@@ -68,6 +70,23 @@ func (mr *MockLoggerMockRecorder) Debugf(arg0, arg1 interface{}, arg2 ...interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Debugf", reflect.TypeOf((*MockLogger)(nil).Debugf), varargs...)
 }
 
+// Debugw mocks base method.
+func (m *MockLogger) Debugw(arg0, arg1 string, arg2 ...interface{}) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Debugw", varargs...)
+}
+
+// Debugw indicates an expected call of Debugw.
+func (mr *MockLoggerMockRecorder) Debugw(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Debugw", reflect.TypeOf((*MockLogger)(nil).Debugw), varargs...)
+}
+
 // Errorf mocks base method.
 func (m *MockLogger) Errorf(arg0, arg1 string, arg2 ...interface{}) {
 	m.ctrl.T.Helper()
@@ -85,6 +104,23 @@ func (mr *MockLoggerMockRecorder) Errorf(arg0, arg1 interface{}, arg2 ...interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Errorf", reflect.TypeOf((*MockLogger)(nil).Errorf), varargs...)
 }
 
+// Errorw mocks base method.
+func (m *MockLogger) Errorw(arg0, arg1 string, arg2 ...interface{}) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Errorw", varargs...)
+}
+
+// Errorw indicates an expected call of Errorw.
+func (mr *MockLoggerMockRecorder) Errorw(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Errorw", reflect.TypeOf((*MockLogger)(nil).Errorw), varargs...)
+}
+
 // Fatalf mocks base method.
 func (m *MockLogger) Fatalf(arg0, arg1 string, arg2 ...interface{}) {
 	m.ctrl.T.Helper()
@@ -102,6 +138,23 @@ func (mr *MockLoggerMockRecorder) Fatalf(arg0, arg1 interface{}, arg2 ...interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fatalf", reflect.TypeOf((*MockLogger)(nil).Fatalf), varargs...)
 }
 
+// Fatalw mocks base method.
+func (m *MockLogger) Fatalw(arg0, arg1 string, arg2 ...interface{}) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Fatalw", varargs...)
+}
+
+// Fatalw indicates an expected call of Fatalw.
+func (mr *MockLoggerMockRecorder) Fatalw(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fatalw", reflect.TypeOf((*MockLogger)(nil).Fatalw), varargs...)
+}
+
 // Flush mocks base method.
 func (m *MockLogger) Flush() {
 	m.ctrl.T.Helper()
@@ -131,6 +184,37 @@ func (mr *MockLoggerMockRecorder) Infof(arg0, arg1 interface{}, arg2 ...interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Infof", reflect.TypeOf((*MockLogger)(nil).Infof), varargs...)
 }
 
+// Infow mocks base method.
+func (m *MockLogger) Infow(arg0, arg1 string, arg2 ...interface{}) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Infow", varargs...)
+}
+
+// Infow indicates an expected call of Infow.
+func (mr *MockLoggerMockRecorder) Infow(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Infow", reflect.TypeOf((*MockLogger)(nil).Infow), varargs...)
+}
+
+// Named mocks base method.
+func (m *MockLogger) Named(arg0 string) Logger {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Named", arg0)
+	ret0, _ := ret[0].(Logger)
+	return ret0
+}
+
+// Named indicates an expected call of Named.
+func (mr *MockLoggerMockRecorder) Named(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Named", reflect.TypeOf((*MockLogger)(nil).Named), arg0)
+}
+
 // NewLine mocks base method.
 func (m *MockLogger) NewLine() {
 	m.ctrl.T.Helper()
@@ -171,3 +255,38 @@ func (mr *MockLoggerMockRecorder) Warnf(arg0, arg1 interface{}, arg2 ...interfac
 	varargs := append([]interface{}{arg0, arg1}, arg2...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Warnf", reflect.TypeOf((*MockLogger)(nil).Warnf), varargs...)
 }
+
+// Warnw mocks base method.
+func (m *MockLogger) Warnw(arg0, arg1 string, arg2 ...interface{}) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Warnw", varargs...)
+}
+
+// Warnw indicates an expected call of Warnw.
+func (mr *MockLoggerMockRecorder) Warnw(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Warnw", reflect.TypeOf((*MockLogger)(nil).Warnw), varargs...)
+}
+
+// With mocks base method.
+func (m *MockLogger) With(arg0 ...interface{}) Logger {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "With", varargs...)
+	ret0, _ := ret[0].(Logger)
+	return ret0
+}
+
+// With indicates an expected call of With.
+func (mr *MockLoggerMockRecorder) With(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "With", reflect.TypeOf((*MockLogger)(nil).With), arg0...)
+}
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"sort"
+	"strings"
+)
+
+// NamespaceSeparator separates the levels of hierarchical namespaces, e.g. "exch.binance.ws"; see Named
+const NamespaceSeparator = "."
+
+// JoinNamespace returns the namespace of name under parent, e.g. "exch.binance" and "ws" give "exch.binance.ws". An
+// empty name, or "*", is parent itself.
+func JoinNamespace(parent, name string) string {
+	switch {
+	case name == "" || name == "*":
+		return parent
+	case parent == "":
+		return name
+	}
+	return parent + NamespaceSeparator + name
+}
+
+// matchNamespacePattern matches namespace against a mask (see matchNamespaceMask), or an exact namespace that also
+// matches its descendants: "exch" matches "exch" and "exch.binance.ws", but not "exchange"
+func matchNamespacePattern(pattern, namespace string) bool {
+	if strings.Contains(pattern, "*") {
+		return matchNamespaceMask(pattern, namespace)
+	}
+	return namespace == pattern || strings.HasPrefix(namespace, pattern+NamespaceSeparator)
+}
+
+// sortNamespacePatterns sorts items from the most specific pattern to the least specific one: exact namespaces first,
+// by decreasing length so that the closest ancestor matches first, then masks by decreasing length
+func sortNamespacePatterns[T any](items []T, pattern func(T) string) []T {
+	res := append([]T(nil), items...)
+	sort.SliceStable(res, func(i, j int) bool {
+		iPattern, jPattern := pattern(res[i]), pattern(res[j])
+		iMask, jMask := strings.Contains(iPattern, "*"), strings.Contains(jPattern, "*")
+		if iMask != jMask {
+			return !iMask
+		}
+		return len(iPattern) > len(jPattern)
+	})
+	return res
+}
+
+// NamespaceOutput routes the messages of the namespaces matching Pattern, an exact namespace (its descendants
+// included) or a mask, to the outputs named in Outputs only
+type NamespaceOutput struct {
+	Pattern string
+	Outputs []string
+}
+
+// NamespaceOutputs is a set of namespace routes; for a given namespace, the most specific pattern wins, like with
+// NamespaceLevels
+type NamespaceOutputs []NamespaceOutput
+
+// Lookup returns the outputs of the most specific pattern matching namespace
+func (no NamespaceOutputs) Lookup(namespace string) ([]string, bool) {
+	for _, o := range no {
+		if matchNamespacePattern(o.Pattern, namespace) {
+			return o.Outputs, true
+		}
+	}
+	return nil, false
+}
+
+func (no NamespaceOutputs) sorted() NamespaceOutputs {
+	return sortNamespacePatterns(no, func(o NamespaceOutput) string { return o.Pattern })
+}
+
+// namespaceSettings are the settings of the namespaces of an AsyncLogger, replaced as a whole
+type namespaceSettings struct {
+	levels  NamespaceLevels
+	outputs NamespaceOutputs
+}
+
+var noNamespaceSettings = &namespaceSettings{}
+
+func (lgr *AsyncLogger) getNamespaceSettings() *namespaceSettings {
+	if ns, ok := lgr.namespaces.Load().(*namespaceSettings); ok {
+		return ns
+	}
+	return noNamespaceSettings
+}
+
+// SetNamespaceLevels sets the minimum levels of the messages of namespaces, inherited by their descendants: with
+// "exch=warn, exch.binance=debug", "exch.okx.ws" logs from WARN and "exch.binance.ws" from DEBUG. Messages below the
+// level of their namespace are dropped before reaching the outputs; the others are still filtered by the level of each
+// output (its minimum level, or its own namespace levels, see OutputHandle.SetNamespaceLevels), so that a namespace
+// level below the level of an output does not make it more verbose.
+func (lgr *AsyncLogger) SetNamespaceLevels(levels NamespaceLevels) {
+	lgr.namespacesMux.Lock()
+	defer lgr.namespacesMux.Unlock()
+	ns := *lgr.getNamespaceSettings()
+	ns.levels = levels.sorted()
+	lgr.namespaces.Store(&ns)
+}
+
+// NamespaceLevels returns the levels set with SetNamespaceLevels
+func (lgr *AsyncLogger) NamespaceLevels() NamespaceLevels {
+	return append(NamespaceLevels(nil), lgr.getNamespaceSettings().levels...)
+}
+
+// SetNamespaceOutputs routes the messages of namespaces, and of their descendants, to the named outputs only (the
+// names are case-insensitive, see OutputName); the messages of other namespaces go to all outputs
+func (lgr *AsyncLogger) SetNamespaceOutputs(outputs NamespaceOutputs) {
+	lgr.namespacesMux.Lock()
+	defer lgr.namespacesMux.Unlock()
+	ns := *lgr.getNamespaceSettings()
+	ns.outputs = outputs.sorted()
+	lgr.namespaces.Store(&ns)
+}
+
+// namespaceAllows reports whether msg is at or above the level of its namespace
+func (lgr *AsyncLogger) namespaceAllows(msg logMessage) bool {
+	level, ok := lgr.getNamespaceSettings().levels.Lookup(msg.namespace)
+	return !ok || uint(msg.level) >= uint(level)
+}
+
+func containsOutput(outputs []string, name string) bool {
+	for _, output := range outputs {
+		if strings.EqualFold(output, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Named implements Logger; the returned logger shares the queue and outputs of lgr
+func (lgr *AsyncLogger) Named(name string) Logger {
+	return &childLogger{parent: lgr, namespace: JoinNamespace("", name)}
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinNamespace(t *testing.T) {
+	assert.Equal(t, "exch.binance.ws", JoinNamespace("exch.binance", "ws"))
+	assert.Equal(t, "exch", JoinNamespace("exch", ""))
+	assert.Equal(t, "exch", JoinNamespace("exch", "*"))
+	assert.Equal(t, "ws", JoinNamespace("", "ws"))
+}
+
+func TestNamespaceLevelsInheritance(t *testing.T) {
+	levels, err := ParseNamespaceLevels("*=info, exch=warn, exch.binance=debug, exch.b*=error")
+	require.NoError(t, err)
+
+	for namespace, expected := range map[string]LogLevel{
+		"exch":            LogLevelWarn,
+		"exch.okx.ws":     LogLevelWarn,
+		"exch.binance":    LogLevelDebug,
+		"exch.binance.ws": LogLevelDebug,
+		"exch.bybit":      LogLevelWarn, // the closest ancestor wins over masks
+		"exchange":        LogLevelInfo,
+		"app":             LogLevelInfo,
+	} {
+		level, ok := levels.Lookup(namespace)
+		assert.True(t, ok, namespace)
+		assert.Equal(t, expected, level, namespace)
+	}
+}
+
+func TestNamedLogger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lgr := NewAsyncLogger(ctx, LogLevelFatal, FilterMatchNone)
+	var all, audit, info syncBuffer
+	lgr.AddOutput(FilterMatchAll, &all, LogLevelDebug, false, true, OutputName("all"))
+	lgr.AddOutput(FilterMatchAll, &audit, LogLevelDebug, false, true, OutputName("Audit"))
+	// the namespace levels of the logger only drop messages, the level of an output still applies
+	lgr.AddOutput(FilterMatchAll, &info, LogLevelInfo, false, true, OutputName("info"))
+
+	levels, err := ParseNamespaceLevels("exch=info, exch.binance.ws=debug")
+	require.NoError(t, err)
+	lgr.SetNamespaceLevels(levels)
+	lgr.SetNamespaceOutputs(NamespaceOutputs{{Pattern: "audit", Outputs: []string{"audit"}}})
+	assert.Equal(t, levels, lgr.NamespaceLevels())
+
+	binance := lgr.Named("exch").With("venue", "binance").Named("binance")
+	binance.Debugf("", "below the level of exch.binance")
+	binance.Infof("*", "connected")
+	binance.Debugw("ws", "ping", "seq", 1)
+	lgr.Named("audit").Named("orders").Infof("", "order sent")
+	lgr.Named("exch").Named("okx").Infof("", "connected")
+	lgr.Named("app").Infof("", "started")
+	lgr.Flush()
+
+	lines := strings.Split(strings.TrimSpace(all.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "(exch.binance) [INFO]: connected venue=binance")
+	assert.Contains(t, lines[1], "(exch.binance.ws) [DEBUG]: ping venue=binance seq=1")
+	assert.Contains(t, lines[2], "(exch.okx) [INFO]: connected")
+	assert.Contains(t, lines[3], "(app) [INFO]: started")
+	infoLines := strings.Split(strings.TrimSpace(info.String()), "\n")
+	require.Len(t, infoLines, 3)
+	assert.NotContains(t, info.String(), "[DEBUG]")
+	// namespaces without a route go to all outputs
+	auditLines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, auditLines, 5)
+	assert.Contains(t, auditLines[2], "(audit.orders) [INFO]: order sent")
+
+	observed := NewObservedLogger(LogLevelDebug)
+	observed.Named("exch").Named("okx").Warnf("ws", "reconnecting")
+	assert.True(t, observed.Contains(LogLevelWarn, "exch.okx.ws", "reconnecting"))
+}
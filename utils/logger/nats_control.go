@@ -0,0 +1,216 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// LogControlNamespace is the namespace used to log the commands received by a LogControl
+var LogControlNamespace = "logctl"
+
+// LogControl subscribes to a NATS subject and applies remote log control commands to an AsyncLogger. Commands are
+// JSON objects; a reply with a LogControlStatus is sent if the request has a reply subject. Supported commands:
+//
+//	{"cmd": "list"}
+//	{"cmd": "setLevel", "output": "file", "level": "debug"}
+//	{"cmd": "setLevels", "output": "stdout", "levels": "WS=debug, *=info"}
+//	{"cmd": "setFilter", "output": "nats", "filter": "WS", "exclude": "^_"}
+//	{"cmd": "dump", "toFile": true}
+//
+// When "output" is omitted, the command applies to all outputs. A dump returns the cached lines in the reply, or with
+// "toFile" appends them to the file set with SetCacheDumpFile; the file can't be chosen remotely.
+type LogControl struct {
+	lgr *AsyncLogger
+	sub *nats.Subscription
+}
+
+// LogControlCommand is a remote log control command
+type LogControlCommand struct {
+	Cmd     string `json:"cmd"`
+	Output  string `json:"output,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Levels  string `json:"levels,omitempty"`
+	Filter  string `json:"filter,omitempty"`
+	Exclude string `json:"exclude,omitempty"`
+	ToFile  bool   `json:"toFile,omitempty"`
+}
+
+// LogControlStatus is the reply to a remote log control command
+type LogControlStatus struct {
+	OK      bool               `json:"ok"`
+	Error   string             `json:"error,omitempty"`
+	Outputs []LogControlOutput `json:"outputs,omitempty"`
+	Dump    []string           `json:"dump,omitempty"`
+	Command *LogControlCommand `json:"command,omitempty"`
+}
+
+// LogControlOutput describes an output in a LogControlStatus
+type LogControlOutput struct {
+	Name   string `json:"name"`
+	Level  string `json:"level"`
+	Levels string `json:"levels,omitempty"`
+}
+
+// NewLogControl subscribes to subject on natsConn and serves log control commands for lgr until Close is called
+func NewLogControl(lgr *AsyncLogger, natsConn *nats.Conn, subject string) (*LogControl, error) {
+	if len(subject) == 0 {
+		return nil, fmt.Errorf("empty log control subject")
+	}
+	lc := &LogControl{lgr: lgr}
+	sub, err := natsConn.Subscribe(subject, lc.handleMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to log control subject %s: %v", subject, err)
+	}
+	lc.sub = sub
+	return lc, nil
+}
+
+// Close stops serving log control commands
+func (lc *LogControl) Close() error {
+	return lc.sub.Unsubscribe()
+}
+
+func (lc *LogControl) handleMsg(msg *nats.Msg) {
+	var cmd LogControlCommand
+	var status LogControlStatus
+	if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+		status.Error = fmt.Sprintf("invalid command: %v", err)
+	} else {
+		status = lc.Execute(cmd)
+	}
+
+	if status.OK {
+		lc.lgr.Infof(LogControlNamespace, "log control command %s", msg.Data)
+	} else {
+		lc.lgr.Warnf(LogControlNamespace, "log control command %s failed: %s", msg.Data, status.Error)
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+	}
+	_ = msg.Respond(data)
+}
+
+// Execute applies a log control command and returns its status
+func (lc *LogControl) Execute(cmd LogControlCommand) LogControlStatus {
+	status := LogControlStatus{Command: &cmd}
+	var err error
+	switch strings.ToLower(cmd.Cmd) {
+	case "list":
+	case "setlevel":
+		err = lc.setLevel(cmd)
+	case "setlevels":
+		err = lc.setLevels(cmd)
+	case "setfilter":
+		err = lc.setFilter(cmd)
+	case "dump":
+		status.Dump, err = lc.dump(cmd)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd.Cmd)
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.OK = true
+	status.Outputs = lc.listOutputs()
+	return status
+}
+
+func (lc *LogControl) setLevel(cmd LogControlCommand) error {
+	level, ok := lookupLogLevel(cmd.Level)
+	if !ok {
+		return fmt.Errorf("unknown level %q", cmd.Level)
+	}
+	return lc.forOutputs(cmd.Output, func(output OutputHandle) {
+		output.SetLevel(level)
+	})
+}
+
+func (lc *LogControl) setLevels(cmd LogControlCommand) error {
+	levels, err := ParseNamespaceLevels(cmd.Levels)
+	if err != nil {
+		return err
+	}
+	return lc.forOutputs(cmd.Output, func(output OutputHandle) {
+		output.SetNamespaceLevels(levels)
+	})
+}
+
+func (lc *LogControl) setFilter(cmd LogControlCommand) error {
+	filter, err := filterFromStrings(cmd.Filter, cmd.Exclude)
+	if err != nil {
+		return err
+	}
+	return lc.forOutputs(cmd.Output, func(output OutputHandle) {
+		output.SetFilter(filter)
+	})
+}
+
+func (lc *LogControl) dump(cmd LogControlCommand) ([]string, error) {
+	if cmd.ToFile {
+		filename := lc.lgr.CacheDumpFile()
+		if filename == "" {
+			return nil, fmt.Errorf("no log cache dump file set")
+		}
+		return nil, lc.lgr.DumpCacheToFile(filename)
+	}
+	var buf bytes.Buffer
+	if err := lc.lgr.DumpCache(&buf); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+// forOutputs calls f for the output named name, or for all outputs if name is empty
+func (lc *LogControl) forOutputs(name string, f func(OutputHandle)) error {
+	if name == "" {
+		for _, output := range lc.lgr.Outputs() {
+			f(output)
+		}
+		return nil
+	}
+	output := lc.lgr.Output(name)
+	if output == nil {
+		return fmt.Errorf("unknown output %q", name)
+	}
+	f(output)
+	return nil
+}
+
+func (lc *LogControl) listOutputs() []LogControlOutput {
+	var outputs []LogControlOutput
+	for _, output := range lc.lgr.Outputs() {
+		outputs = append(outputs, LogControlOutput{
+			Name:   output.Name(),
+			Level:  strings.ToLower(logLevels[output.Level()]),
+			Levels: output.NamespaceLevels().String(),
+		})
+	}
+	return outputs
+}
+
+// filterFromStrings builds a filter matching filter (all if empty) and not matching exclude (none if empty)
+func filterFromStrings(filter, exclude string) (f FilterFunc, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid filter: %v", r)
+		}
+	}()
+	f = FilterMatchAll
+	if filter != "" {
+		f = Filter(filter)
+	}
+	if exclude != "" {
+		f = And(f, Not(exclude))
+	}
+	return f, nil
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runTestNatsServer(t *testing.T) *server.Server {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	require.NoError(t, err)
+	go srv.Start()
+	require.True(t, srv.ReadyForConnections(5*time.Second), "nats server not ready")
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestLogControl(t *testing.T) {
+	srv := runTestNatsServer(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	testLogger := &AsyncLogger{logs: make(chan logMessage), cache: newLogCache(10), cacheFormatter: NewSimpleFormatter(false, true)}
+	go testLogger.handleLogs(ctx)
+	handle := testLogger.AddOutput(FilterMatchAll, &nopWriter{}, LogLevelInfo, false, true, OutputName("file"))
+
+	lc, err := NewLogControl(testLogger, nc, "log.control")
+	require.NoError(t, err)
+	defer lc.Close()
+
+	request := func(cmd LogControlCommand) LogControlStatus {
+		data, _ := json.Marshal(cmd)
+		reply, err := nc.Request("log.control", data, 2*time.Second)
+		require.NoError(t, err)
+		var status LogControlStatus
+		require.NoError(t, json.Unmarshal(reply.Data, &status))
+		return status
+	}
+
+	status := request(LogControlCommand{Cmd: "setLevel", Output: "file", Level: "debug"})
+	assert.True(t, status.OK, status.Error)
+	assert.Equal(t, LogLevel(LogLevelDebug), handle.Level())
+
+	status = request(LogControlCommand{Cmd: "setLevels", Levels: "WS=warn"})
+	assert.True(t, status.OK, status.Error)
+	assert.Equal(t, []LogControlOutput{{Name: "file", Level: "debug", Levels: "WS=warn"}}, status.Outputs)
+
+	testLogger.Infof("WS", "cached line")
+	status = request(LogControlCommand{Cmd: "dump"})
+	assert.True(t, status.OK, status.Error)
+	require.NotEmpty(t, status.Dump)
+	assert.Contains(t, status.Dump[len(status.Dump)-2], "(WS) [INFO]: cached line")
+	assert.Equal(t, "====== end of log cache dump ======", status.Dump[len(status.Dump)-1])
+
+	status = request(LogControlCommand{Cmd: "dump", ToFile: true})
+	assert.False(t, status.OK)
+	assert.Equal(t, "no log cache dump file set", status.Error)
+	dumpFile := filepath.Join(t.TempDir(), "dump.log")
+	testLogger.SetCacheDumpFile(dumpFile)
+	status = request(LogControlCommand{Cmd: "dump", ToFile: true})
+	assert.True(t, status.OK, status.Error)
+	assert.Empty(t, status.Dump)
+	dump, err := os.ReadFile(dumpFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(dump), "(WS) [INFO]: cached line")
+
+	status = request(LogControlCommand{Cmd: "setLevel", Output: "nope", Level: "debug"})
+	assert.False(t, status.OK)
+	assert.Equal(t, `unknown output "nope"`, status.Error)
+
+	status = request(LogControlCommand{Cmd: "setFilter", Filter: "("})
+	assert.False(t, status.OK)
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,506 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DurableNatsPublisher implements io.Writer and publishes each write to a NATS subject without losing logs while NATS
+// is unavailable. Writes never block: messages are queued in memory and published by a background goroutine. While
+// disconnected, the queue keeps up to BufferSize messages; the overflow is appended to a spill file in SpillDir if set
+// (otherwise the oldest messages are dropped). Everything is replayed in order once NATS is back. On Close, the
+// messages not yet published are saved to the spill file and replayed by the next publisher using the same SpillDir
+// and subject.
+//
+// With JetStream, each message is published to the stream capturing the subject and its ack awaited; messages are
+// retried until acknowledged.
+type DurableNatsPublisher struct {
+	mux sync.Mutex
+
+	subject string
+	opts    NatsPublisherOptions
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+
+	queue        [][]byte // oldest first
+	inFlight     bool     // queue[0] is being published, see publishPending
+	spillFile    *os.File // append handle, nil when there is nothing spilled
+	spillPath    string
+	spillOffset  int64 // offset of the first record not yet loaded back into the queue
+	spillSize    int64
+	spillRecords int // records in the spill file not yet loaded back into the queue
+	dropped      uint64
+	lastErr      error
+
+	streamReady bool
+
+	wake      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NatsPublisherOptions configures a DurableNatsPublisher
+type NatsPublisherOptions struct {
+	// BufferSize is the number of messages queued in memory; 0 means 10000
+	BufferSize int
+
+	// SpillDir is the directory of the spill file holding the messages that don't fit in memory; empty disables
+	// spilling
+	SpillDir string
+
+	// MaxSpillSize is the maximum size in bytes of the spill file; 0 is unlimited
+	MaxSpillSize int64
+
+	// JetStream publishes with JetStream and waits for the acks
+	JetStream bool
+
+	// Stream is created with the subject if it doesn't exist, when JetStream is set; empty means the stream is
+	// provisioned separately
+	Stream string
+
+	// AckTimeout is how long a JetStream ack is waited for; 0 means 5s
+	AckTimeout time.Duration
+
+	// RetryInterval is the time between publish attempts after a failure; 0 means 1s
+	RetryInterval time.Duration
+}
+
+// NewDurableNatsPublisher connects to the NATS server at url and starts publishing to subject. The connection is
+// retried forever, so the publisher is created even if NATS is unavailable. natsOpts are applied after the options
+// set by the publisher (e.g. for credentials).
+func NewDurableNatsPublisher(url, subject string, opts NatsPublisherOptions, natsOpts ...nats.Option) (*DurableNatsPublisher, error) {
+	if len(subject) == 0 {
+		return nil, fmt.Errorf("empty publishing subject")
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 5 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+
+	p := &DurableNatsPublisher{
+		subject: subject,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if opts.SpillDir != "" {
+		if err := p.openSpill(); err != nil {
+			return nil, err
+		}
+	}
+
+	connOpts := append([]nats.Option{
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		// fail publishes while disconnected, the publisher does the buffering
+		nats.ReconnectBufSize(-1),
+		nats.ConnectHandler(func(*nats.Conn) { p.signal() }),
+		nats.ReconnectHandler(func(*nats.Conn) { p.signal() }),
+	}, natsOpts...)
+	nc, err := nats.Connect(url, connOpts...)
+	if err != nil {
+		p.closeSpill()
+		return nil, fmt.Errorf("unable to connect to NATS %s: %v", url, err)
+	}
+	p.nc = nc
+	if opts.JetStream {
+		if p.js, err = nc.JetStream(nats.MaxWait(opts.AckTimeout)); err != nil {
+			nc.Close()
+			p.closeSpill()
+			return nil, fmt.Errorf("unable to create JetStream context: %v", err)
+		}
+	}
+
+	go p.run()
+	p.signal()
+	return p, nil
+}
+
+// Conn returns the NATS connection of the publisher
+func (p *DurableNatsPublisher) Conn() *nats.Conn {
+	return p.nc
+}
+
+// Write implements io.Writer; the message is queued for publishing. An error is returned if the message, or an older
+// one, had to be dropped because the buffers are full.
+func (p *DurableNatsPublisher) Write(b []byte) (int, error) {
+	n := len(b)
+	if n > 0 && b[n-1] == '\n' {
+		b = b[:n-1]
+	}
+	msg := append([]byte(nil), b...)
+
+	p.mux.Lock()
+	err := p.push(msg)
+	p.mux.Unlock()
+
+	p.signal()
+	return n, err
+}
+
+// Pending returns the number of messages waiting to be published, in memory and spilled
+func (p *DurableNatsPublisher) Pending() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.queue) + p.spillRecords
+}
+
+// Dropped returns the number of messages dropped because the buffers were full
+func (p *DurableNatsPublisher) Dropped() uint64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.dropped
+}
+
+// LastError returns the last publish error, if any
+func (p *DurableNatsPublisher) LastError() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.lastErr
+}
+
+// Close publishes what it can within the ack timeout, saves the rest to the spill file (if any) and closes the NATS
+// connection
+func (p *DurableNatsPublisher) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		<-p.stopped
+
+		p.mux.Lock()
+		defer p.mux.Unlock()
+		err = p.persist()
+		p.closeSpill()
+		if p.nc.IsConnected() {
+			_ = p.nc.FlushTimeout(p.opts.AckTimeout)
+		}
+		p.nc.Close()
+	})
+	return err
+}
+
+func (p *DurableNatsPublisher) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push queues msg; must be called with mux locked
+func (p *DurableNatsPublisher) push(msg []byte) error {
+	// once something is spilled, new messages follow it to keep the order
+	if p.spillRecords == 0 && len(p.queue) < p.opts.BufferSize {
+		p.queue = append(p.queue, msg)
+		return nil
+	}
+	if p.opts.SpillDir != "" {
+		err := p.spill(msg)
+		if err == nil {
+			return nil
+		}
+		p.dropped++
+		return fmt.Errorf("nats publisher: message dropped: %v", err)
+	}
+	p.dropped++
+	if p.inFlight {
+		// the oldest message is being published and popped once done, so the next one is dropped
+		if len(p.queue) < 2 {
+			return fmt.Errorf("nats publisher: buffer full, message dropped")
+		}
+		p.queue[1] = nil
+		p.queue = append(p.queue[:1], p.queue[2:]...)
+	} else {
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+	}
+	p.queue = append(p.queue, msg)
+	return fmt.Errorf("nats publisher: buffer full, oldest message dropped")
+}
+
+func (p *DurableNatsPublisher) run() {
+	defer close(p.stopped)
+
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-p.wake:
+		case <-retry:
+		case <-p.done:
+			p.publishPending()
+			return
+		}
+		retry = nil
+		if !p.publishPending() {
+			retry = time.After(p.opts.RetryInterval)
+		}
+	}
+}
+
+// publishPending publishes the queued messages, oldest first, until there are none left or publishing fails
+func (p *DurableNatsPublisher) publishPending() bool {
+	for {
+		msg, ok := p.peek()
+		if !ok {
+			return true
+		}
+		if !p.nc.IsConnected() {
+			return false
+		}
+		if err := p.publish(msg); err != nil {
+			p.mux.Lock()
+			p.lastErr = err
+			p.inFlight = false
+			p.mux.Unlock()
+			return false
+		}
+		p.pop()
+	}
+}
+
+func (p *DurableNatsPublisher) publish(msg []byte) error {
+	if p.js == nil {
+		return p.nc.Publish(p.subject, msg)
+	}
+	if !p.streamReady && p.opts.Stream != "" {
+		if err := p.ensureStream(); err != nil {
+			return err
+		}
+	}
+	_, err := p.js.Publish(p.subject, msg)
+	return err
+}
+
+// ensureStream creates the stream if it doesn't exist
+func (p *DurableNatsPublisher) ensureStream() error {
+	_, err := p.js.StreamInfo(p.opts.Stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = p.js.AddStream(&nats.StreamConfig{Name: p.opts.Stream, Subjects: []string{p.subject}})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to set up stream %s: %v", p.opts.Stream, err)
+	}
+	p.streamReady = true
+	return nil
+}
+
+// peek returns the oldest queued message, loading spilled messages back into the queue if it is empty, and marks it in
+// flight so that push doesn't drop it before pop
+func (p *DurableNatsPublisher) peek() ([]byte, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if len(p.queue) == 0 && p.spillRecords > 0 {
+		if err := p.loadSpill(); err != nil {
+			p.lastErr = err
+		}
+	}
+	if len(p.queue) == 0 {
+		return nil, false
+	}
+	p.inFlight = true
+	return p.queue[0], true
+}
+
+// pop removes the message returned by peek, once published
+func (p *DurableNatsPublisher) pop() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.inFlight = false
+	p.queue[0] = nil
+	p.queue = p.queue[1:]
+}
+
+// spillFileName returns the name of the spill file of the publisher
+func (p *DurableNatsPublisher) spillFileName() string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '*' || r == '>' {
+			return '_'
+		}
+		return r
+	}, p.subject)
+	return filepath.Join(p.opts.SpillDir, name+".spill")
+}
+
+// openSpill opens the spill file left by a previous publisher, if any, so that its messages are replayed first
+func (p *DurableNatsPublisher) openSpill() error {
+	if err := os.MkdirAll(p.opts.SpillDir, 0755); err != nil {
+		return fmt.Errorf("failed to create spill dir: %v", err)
+	}
+	p.spillPath = p.spillFileName()
+	file, err := os.Open(p.spillPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %v", err)
+	}
+	defer file.Close()
+
+	// count the complete records; a truncated last record is discarded
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		n, err := skipSpillRecord(reader)
+		if err != nil {
+			break
+		}
+		size += n
+		p.spillRecords++
+	}
+	if p.spillRecords == 0 {
+		return os.Remove(p.spillPath)
+	}
+	if err := os.Truncate(p.spillPath, size); err != nil {
+		return fmt.Errorf("failed to open spill file: %v", err)
+	}
+	p.spillSize = size
+	p.spillFile, err = os.OpenFile(p.spillPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %v", err)
+	}
+	return nil
+}
+
+// spill appends msg to the spill file; must be called with mux locked
+func (p *DurableNatsPublisher) spill(msg []byte) error {
+	recordSize := int64(4 + len(msg))
+	if p.opts.MaxSpillSize > 0 && p.spillSize+recordSize > p.opts.MaxSpillSize {
+		return fmt.Errorf("spill file full")
+	}
+	if p.spillFile == nil {
+		p.spillPath = p.spillFileName()
+		file, err := os.OpenFile(p.spillPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		p.spillFile = file
+		p.spillOffset, p.spillSize = 0, 0
+	}
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record, uint32(len(msg)))
+	copy(record[4:], msg)
+	if _, err := p.spillFile.Write(record); err != nil {
+		return err
+	}
+	p.spillSize += recordSize
+	p.spillRecords++
+	return nil
+}
+
+// loadSpill moves up to BufferSize spilled messages to the queue; the spill file is removed once fully loaded. Must
+// be called with mux locked.
+func (p *DurableNatsPublisher) loadSpill() error {
+	file, err := os.Open(p.spillPath)
+	if err != nil {
+		return fmt.Errorf("failed to read spill file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(p.spillOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read spill file: %v", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for p.spillRecords > 0 && len(p.queue) < p.opts.BufferSize {
+		msg, err := readSpillRecord(reader)
+		if err != nil {
+			// unreadable records are lost
+			p.dropped += uint64(p.spillRecords)
+			p.spillRecords = 0
+			break
+		}
+		p.queue = append(p.queue, msg)
+		p.spillOffset += int64(4 + len(msg))
+		p.spillRecords--
+	}
+	if p.spillRecords == 0 {
+		p.closeSpill()
+		_ = os.Remove(p.spillPath)
+	}
+	return nil
+}
+
+// persist saves the queued and spilled messages to a new spill file, in order; must be called with mux locked
+func (p *DurableNatsPublisher) persist() error {
+	if p.opts.SpillDir == "" || len(p.queue) == 0 && p.spillOffset == 0 {
+		return nil
+	}
+	tmpPath := p.spillFileName() + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save unpublished logs: %v", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, msg := range p.queue {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(msg)))
+		writer.Write(size[:])
+		writer.Write(msg)
+	}
+	if p.spillRecords > 0 {
+		if spilled, err := os.Open(p.spillPath); err == nil {
+			if _, err = spilled.Seek(p.spillOffset, io.SeekStart); err == nil {
+				_, _ = io.Copy(writer, spilled)
+			}
+			spilled.Close()
+		}
+	}
+	err = writer.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, p.spillFileName())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save unpublished logs: %v", err)
+	}
+	return nil
+}
+
+func (p *DurableNatsPublisher) closeSpill() {
+	if p.spillFile != nil {
+		p.spillFile.Close()
+		p.spillFile = nil
+	}
+}
+
+func readSpillRecord(reader *bufio.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func skipSpillRecord(reader *bufio.Reader) (int64, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); err != nil {
+		return 0, err
+	}
+	n := int64(binary.BigEndian.Uint32(size[:]))
+	if _, err := io.CopyN(io.Discard, reader, n); err != nil {
+		return 0, err
+	}
+	return 4 + n, nil
+}
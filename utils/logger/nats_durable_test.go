@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// freeTestPort returns a port with nothing listening on it
+func freeTestPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func runTestNatsServerOn(t *testing.T, port int, jetStream bool) *server.Server {
+	opts := &server.Options{Host: "127.0.0.1", Port: port, NoLog: true, NoSigs: true}
+	if jetStream {
+		opts.JetStream = true
+		opts.StoreDir = t.TempDir()
+	}
+	srv, err := server.NewServer(opts)
+	require.NoError(t, err)
+	go srv.Start()
+	require.True(t, srv.ReadyForConnections(5*time.Second), "nats server not ready")
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestDurableNatsPublisher(t *testing.T) {
+	srv := runTestNatsServer(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("logs")
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	p, err := NewDurableNatsPublisher(srv.ClientURL(), "logs", NatsPublisherOptions{})
+	require.NoError(t, err)
+	defer p.Close()
+
+	_, err = p.Write([]byte("hello\n"))
+	assert.NoError(t, err)
+	msg, err := sub.NextMsg(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(msg.Data))
+}
+
+func TestDurableNatsPublisherSpill(t *testing.T) {
+	port := freeTestPort(t)
+	url := fmt.Sprintf("nats://127.0.0.1:%d", port)
+	spillDir := t.TempDir()
+
+	// NATS is down: the publisher starts anyway, and keeps everything
+	p, err := NewDurableNatsPublisher(url, "logs", NatsPublisherOptions{BufferSize: 2, SpillDir: spillDir})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = p.Write([]byte(fmt.Sprintf("message %d\n", i)))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, p.Pending())
+	require.NoError(t, p.Close())
+
+	// the next publisher replays the saved messages, then the new ones, in order
+	srv := runTestNatsServerOn(t, port, false)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("logs")
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	p, err = NewDurableNatsPublisher(url, "logs", NatsPublisherOptions{BufferSize: 2, SpillDir: spillDir})
+	require.NoError(t, err)
+	defer p.Close()
+	_, err = p.Write([]byte("message 5\n"))
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		msg, err := sub.NextMsg(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("message %d", i), string(msg.Data))
+	}
+	assert.Eventually(t, func() bool { return p.Pending() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), p.Dropped())
+}
+
+func TestDurableNatsPublisherJetStream(t *testing.T) {
+	port := freeTestPort(t)
+	url := fmt.Sprintf("nats://127.0.0.1:%d", port)
+
+	p, err := NewDurableNatsPublisher(url, "logs.app", NatsPublisherOptions{JetStream: true, Stream: "LOGS", RetryInterval: 10 * time.Millisecond},
+		nats.ReconnectWait(10*time.Millisecond))
+	require.NoError(t, err)
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err = p.Write([]byte(fmt.Sprintf("message %d\n", i)))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, p.Pending())
+
+	// once NATS is up, the stream is created and the messages are published and acknowledged
+	runTestNatsServerOn(t, port, true)
+	assert.Eventually(t, func() bool { return p.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	js, err := p.Conn().JetStream()
+	require.NoError(t, err)
+	info, err := js.StreamInfo("LOGS")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), info.State.Msgs)
+	msg, err := js.GetMsg("LOGS", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "message 0", string(msg.Data))
+}
+
+func TestDurableNatsPublisherDropInFlight(t *testing.T) {
+	p := &DurableNatsPublisher{opts: NatsPublisherOptions{BufferSize: 2}}
+	require.NoError(t, p.push([]byte("1")))
+	require.NoError(t, p.push([]byte("2")))
+
+	// "1" is being published while the buffer overflows: "2" is dropped instead
+	msg, ok := p.peek()
+	require.True(t, ok)
+	assert.Equal(t, "1", string(msg))
+	assert.Error(t, p.push([]byte("3")))
+	p.pop()
+	msg, _ = p.peek()
+	assert.Equal(t, "3", string(msg))
+	assert.Equal(t, uint64(1), p.dropped)
+
+	// nothing in flight, the oldest is dropped
+	p.inFlight = false
+	assert.NoError(t, p.push([]byte("4")))
+	assert.Error(t, p.push([]byte("5")))
+	assert.Equal(t, [][]byte{[]byte("4"), []byte("5")}, p.queue)
+}
@@ -17,10 +17,10 @@ func NewNatsLogger(subject string, natsConn *nats.Conn) *NatsLogger {
 
 func (nl *NatsLogger) Write(p []byte) (n int, err error) {
 	l := len(p)
-	if p[l-1] == '\n' {
-		nl.natsConn.Publish(nl.subj, p[:l-1])
+	if l > 0 && p[l-1] == '\n' {
+		err = nl.natsConn.Publish(nl.subj, p[:l-1])
 	} else {
-		nl.natsConn.Publish(nl.subj, p)
+		err = nl.natsConn.Publish(nl.subj, p)
 	}
-	return l, nil
+	return l, err
 }
@@ -0,0 +1,208 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ObservedLogger is a Logger recording the messages in memory, for tests asserting on what the code under test logs.
+// Messages are recorded synchronously, as LogRecords. Errorf/Errorw return and Fatalf/Fatalw do not exit: they are
+// recorded like the other levels. Outputs can't be added: AddOutput returns nil.
+//
+// To observe the global logger:
+//
+//	observed := logger.NewObservedLogger(logger.LogLevelDebug)
+//	utils.GetOrCreateGlobalContext(cfg, observed.Factory())
+type ObservedLogger struct {
+	store     *observedStore
+	fields    []Field
+	namespace string // see Named
+}
+
+// observedStore holds the records of an ObservedLogger and its children
+type observedStore struct {
+	mux      sync.Mutex
+	minLevel LogLevel
+	records  []LogRecord
+	changed  chan struct{} // closed and replaced on each record, see WaitFor
+}
+
+// NewObservedLogger creates an ObservedLogger recording messages at minLevel and above
+func NewObservedLogger(minLevel LogLevel) *ObservedLogger {
+	return &ObservedLogger{store: &observedStore{minLevel: minLevel, changed: make(chan struct{})}}
+}
+
+// Factory returns a logger factory, accepted as an option by GetOrCreateGlobalContext in package utils, returning ol.
+// The level passed to the factory replaces the minimum level of ol; the filter is ignored.
+func (ol *ObservedLogger) Factory() func(context.Context, LogLevel, FilterFunc) Logger {
+	return func(_ context.Context, level LogLevel, _ FilterFunc) Logger {
+		ol.store.mux.Lock()
+		ol.store.minLevel = level
+		ol.store.mux.Unlock()
+		return ol
+	}
+}
+
+func (ol *ObservedLogger) record(level LogLevel, namespace, message string, fields []Field) {
+	s := ol.store
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if uint(level) < uint(s.minLevel) {
+		return
+	}
+	s.records = append(s.records, LogRecord{
+		Time:      currentClock.Now().UTC(),
+		Level:     level,
+		Namespace: JoinNamespace(ol.namespace, namespace),
+		Message:   message,
+		Fields:    appendFields(ol.fields, fields),
+	})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Records returns the recorded messages, oldest first
+func (ol *ObservedLogger) Records() []LogRecord {
+	ol.store.mux.Lock()
+	defer ol.store.mux.Unlock()
+	return append([]LogRecord(nil), ol.store.records...)
+}
+
+// Reset forgets the recorded messages
+func (ol *ObservedLogger) Reset() {
+	ol.store.mux.Lock()
+	defer ol.store.mux.Unlock()
+	ol.store.records = nil
+}
+
+// Matching returns the recorded messages at level, in a namespace matching the namespace mask ('*' matches any
+// sequence of characters) and with a message matching the regular expression pattern ("" matches any message)
+func (ol *ObservedLogger) Matching(level LogLevel, namespace, pattern string) []LogRecord {
+	re := regexp.MustCompile(pattern)
+	var res []LogRecord
+	for _, rec := range ol.Records() {
+		if rec.Level == level && matchNamespaceMask(namespace, rec.Namespace) && re.MatchString(rec.Message) {
+			res = append(res, rec)
+		}
+	}
+	return res
+}
+
+// Contains reports whether a message matching level, namespace and pattern has been recorded, see Matching
+func (ol *ObservedLogger) Contains(level LogLevel, namespace, pattern string) bool {
+	return len(ol.Matching(level, namespace, pattern)) > 0
+}
+
+// Count returns the number of recorded messages at level
+func (ol *ObservedLogger) Count(level LogLevel) int {
+	ol.store.mux.Lock()
+	defer ol.store.mux.Unlock()
+	n := 0
+	for _, rec := range ol.store.records {
+		if rec.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// WaitFor waits until a message matching level, namespace and pattern is recorded (see Matching), for at most
+// timeout; returns false on timeout. Use it for messages logged by other goroutines.
+func (ol *ObservedLogger) WaitFor(level LogLevel, namespace, pattern string, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		ol.store.mux.Lock()
+		changed := ol.store.changed
+		ol.store.mux.Unlock()
+		if ol.Contains(level, namespace, pattern) {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// Debugf implements Logger
+func (ol *ObservedLogger) Debugf(namespace, format string, a ...interface{}) {
+	ol.record(LogLevelDebug, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Infof implements Logger
+func (ol *ObservedLogger) Infof(namespace, format string, a ...interface{}) {
+	ol.record(LogLevelInfo, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Warnf implements Logger
+func (ol *ObservedLogger) Warnf(namespace, format string, a ...interface{}) {
+	ol.record(LogLevelWarn, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Errorf implements Logger; does not panic
+func (ol *ObservedLogger) Errorf(namespace, format string, a ...interface{}) {
+	ol.record(LogLevelError, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Fatalf implements Logger; does not exit
+func (ol *ObservedLogger) Fatalf(namespace, format string, a ...interface{}) {
+	ol.record(LogLevelFatal, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Debugw implements Logger
+func (ol *ObservedLogger) Debugw(namespace, msg string, keysAndValues ...interface{}) {
+	ol.record(LogLevelDebug, namespace, msg, fieldsFromArgs(keysAndValues))
+}
+
+// Infow implements Logger
+func (ol *ObservedLogger) Infow(namespace, msg string, keysAndValues ...interface{}) {
+	ol.record(LogLevelInfo, namespace, msg, fieldsFromArgs(keysAndValues))
+}
+
+// Warnw implements Logger
+func (ol *ObservedLogger) Warnw(namespace, msg string, keysAndValues ...interface{}) {
+	ol.record(LogLevelWarn, namespace, msg, fieldsFromArgs(keysAndValues))
+}
+
+// Errorw implements Logger; does not panic
+func (ol *ObservedLogger) Errorw(namespace, msg string, keysAndValues ...interface{}) {
+	ol.record(LogLevelError, namespace, msg, fieldsFromArgs(keysAndValues))
+}
+
+// Fatalw implements Logger; does not exit
+func (ol *ObservedLogger) Fatalw(namespace, msg string, keysAndValues ...interface{}) {
+	ol.record(LogLevelFatal, namespace, msg, fieldsFromArgs(keysAndValues))
+}
+
+// With implements Logger; the child records into the same ObservedLogger
+func (ol *ObservedLogger) With(keysAndValues ...interface{}) Logger {
+	return &ObservedLogger{store: ol.store, fields: appendFields(ol.fields, fieldsFromArgs(keysAndValues)), namespace: ol.namespace}
+}
+
+// Named implements Logger; the child records into the same ObservedLogger
+func (ol *ObservedLogger) Named(name string) Logger {
+	return &ObservedLogger{store: ol.store, fields: ol.fields, namespace: JoinNamespace(ol.namespace, name)}
+}
+
+// AddOutput implements Logger; does nothing
+func (ol *ObservedLogger) AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, opts ...interface{}) OutputHandle {
+	return nil
+}
+
+// Flush implements Logger; messages are recorded synchronously
+func (ol *ObservedLogger) Flush() {
+}
+
+// NewLine implements Logger; does nothing
+func (ol *ObservedLogger) NewLine() {
+}
+
+// NoDateNextLine implements Logger; does nothing
+func (ol *ObservedLogger) NoDateNextLine() {
+}
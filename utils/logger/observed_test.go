@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservedLogger(t *testing.T) {
+	observed := NewObservedLogger(LogLevelInfo)
+	var lgr Logger = observed
+
+	lgr.Debugf("WS", "not recorded")
+	lgr.Infof("WS", "connected to %s", "binance")
+	lgr.With("id", 7).Warnw("WS.orders", "order rejected", "reason", "margin")
+	lgr.Errorf("MD", "feed stalled")
+	lgr.Fatalw("MD", "giving up")
+
+	records := observed.Records()
+	require.Len(t, records, 4)
+	assert.Equal(t, []Field{{Key: "id", Value: 7}, {Key: "reason", Value: "margin"}}, records[1].Fields)
+
+	assert.True(t, observed.Contains(LogLevelInfo, "WS", "^connected to binance$"))
+	assert.True(t, observed.Contains(LogLevelWarn, "WS*", "rejected"))
+	assert.False(t, observed.Contains(LogLevelWarn, "WS", "rejected"))
+	assert.False(t, observed.Contains(LogLevelDebug, "*", ""))
+	assert.Len(t, observed.Matching(LogLevelError, "*", ""), 1)
+	assert.Equal(t, 1, observed.Count(LogLevelFatal))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lgr.Infof("WS", "disconnected")
+	}()
+	assert.True(t, observed.WaitFor(LogLevelInfo, "WS", "disconnected", time.Second))
+	assert.False(t, observed.WaitFor(LogLevelInfo, "WS", "never", 10*time.Millisecond))
+
+	observed.Reset()
+	assert.Empty(t, observed.Records())
+
+	lgr = observed.Factory()(nil, LogLevelDebug, FilterMatchNone)
+	lgr.Debugf("_hidden", "recorded")
+	assert.Equal(t, 1, observed.Count(LogLevelDebug))
+}
@@ -0,0 +1,333 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OutputHandle controls a log output after it has been added to a logger. All methods are safe to call while the
+// logger is running.
+type OutputHandle interface {
+	// Name returns the name of the output, as set with the OutputName option of AddOutput
+	Name() string
+
+	// Level returns the minimum level of the output
+	Level() LogLevel
+
+	// SetLevel changes the minimum level of the output
+	SetLevel(level LogLevel)
+
+	// SetFilter changes the namespace filter of the output
+	SetFilter(filter FilterFunc)
+
+	// NamespaceLevels returns the per-namespace level overrides of the output
+	NamespaceLevels() NamespaceLevels
+
+	// SetNamespaceLevels sets per-namespace level overrides that take precedence over the minimum level
+	SetNamespaceLevels(levels NamespaceLevels)
+
+	// SourceInfo returns the source information written with the messages
+	SourceInfo() SourceInfo
+
+	// SetSourceInfo changes the source information written with the messages
+	SetSourceInfo(info SourceInfo)
+
+	// Stats returns the counters of the output
+	Stats() OutputStats
+
+	// Remove removes the output from its logger
+	Remove()
+}
+
+// OutputStats are the counters of an output
+type OutputStats struct {
+	Written   uint64 // messages written
+	Dropped   uint64 // messages dropped because the output queue was full
+	Errors    uint64 // failed writes
+	LastError error  // last write error, if any
+}
+
+// OutputName is an AddOutput option naming the output, so it can be looked up later with AsyncLogger.Output
+type OutputName string
+
+// OutputQueueSize is an AddOutput option setting the size of the output queue
+type OutputQueueSize int
+
+// LogOutputQueueSize is the default size of the queue of messages waiting to be written by an output; the messages
+// are dropped for the output while it is full
+var LogOutputQueueSize = 1024
+
+// DefaultOutputName is the name of the stdout output created with a new AsyncLogger
+const DefaultOutputName = "stdout"
+
+// NamespaceLevel is a minimum log level applying to namespaces matching Pattern. The pattern is either an exact
+// namespace, which also applies to its descendants in the dotted hierarchy (e.g. "exch" to "exch.binance.ws"), or a
+// mask where '*' matches any sequence of characters (e.g. "WS*" or "*").
+type NamespaceLevel struct {
+	Pattern string
+	Level   LogLevel
+}
+
+// NamespaceLevels is a set of per-namespace level overrides. For a given namespace, an exact pattern wins, then the
+// closest ancestor, then masks, longer masks winning over shorter ones.
+type NamespaceLevels []NamespaceLevel
+
+// ParseNamespaceLevels parses a spec like "WS=debug, exch*=warn, *=info" into NamespaceLevels
+func ParseNamespaceLevels(spec string) (NamespaceLevels, error) {
+	var levels NamespaceLevels
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid namespace level %q: expected namespace=level", item)
+		}
+		pattern, rawLevel := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		level, ok := lookupLogLevel(rawLevel)
+		if !ok {
+			return nil, fmt.Errorf("invalid namespace level %q: unknown level %q", item, rawLevel)
+		}
+		if pattern == "" {
+			pattern = "*"
+		}
+		levels = append(levels, NamespaceLevel{Pattern: pattern, Level: level})
+	}
+	return levels.sorted(), nil
+}
+
+// String returns the levels in the format accepted by ParseNamespaceLevels
+func (nl NamespaceLevels) String() string {
+	items := make([]string, 0, len(nl))
+	for _, l := range nl {
+		items = append(items, l.Pattern+"="+strings.ToLower(logLevels[l.Level]))
+	}
+	return strings.Join(items, ", ")
+}
+
+// Lookup returns the level of the most specific pattern matching namespace
+func (nl NamespaceLevels) Lookup(namespace string) (LogLevel, bool) {
+	// sorted: exact patterns by decreasing length, then masks by decreasing length
+	for _, l := range nl {
+		if matchNamespacePattern(l.Pattern, namespace) {
+			return l.Level, true
+		}
+	}
+	return 0, false
+}
+
+func (nl NamespaceLevels) sorted() NamespaceLevels {
+	return sortNamespacePatterns(nl, func(l NamespaceLevel) string { return l.Pattern })
+}
+
+// matchNamespaceMask matches namespace against a mask where '*' matches any sequence of characters
+func matchNamespaceMask(mask, namespace string) bool {
+	parts := strings.Split(mask, "*")
+	if len(parts) == 1 {
+		return mask == namespace
+	}
+	if !strings.HasPrefix(namespace, parts[0]) {
+		return false
+	}
+	namespace = namespace[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		n := strings.Index(namespace, part)
+		if n < 0 {
+			return false
+		}
+		namespace = namespace[n+len(part):]
+	}
+	return strings.HasSuffix(namespace, parts[len(parts)-1])
+}
+
+type logOutput struct {
+	// counters; first in the struct for 64-bit alignment of atomic operations
+	written uint64
+	dropped uint64
+	errors  uint64
+
+	mux sync.RWMutex
+
+	name      string
+	filter    FilterFunc
+	dst       io.Writer
+	minLevel  LogLevel
+	nsLevels  NamespaceLevels
+	formatter Formatter
+
+	sourceInfo uint32      // SourceInfo, see SetSourceInfo
+	dedup      OutputDedup // repeated messages are merged if set
+
+	owner *AsyncLogger
+
+	// queue written by the output's own goroutine; see output_worker.go
+	queueMux     sync.RWMutex
+	queue        chan logMessage
+	queueSize    int
+	startOnce    sync.Once
+	closed       bool
+	lastErr      error
+	lastReported time.Time
+	unreported   uint64
+}
+
+// accepts reports whether a message with namespace and level should be written to the output; the namespace levels
+// of the output win over its minimum level. The namespace levels of the logger are applied before, see namespaceAllows.
+func (lo *logOutput) accepts(namespace string, level LogLevel) bool {
+	lo.mux.RLock()
+	defer lo.mux.RUnlock()
+
+	if ok := lo.filter(namespace); !ok {
+		return false
+	}
+	minLevel := lo.minLevel
+	if nsLevel, ok := lo.nsLevels.Lookup(namespace); ok {
+		minLevel = nsLevel
+	}
+	return uint(minLevel) <= uint(level)
+}
+
+// Name implements OutputHandle
+func (lo *logOutput) Name() string {
+	return lo.name
+}
+
+// Level implements OutputHandle
+func (lo *logOutput) Level() LogLevel {
+	lo.mux.RLock()
+	defer lo.mux.RUnlock()
+	return lo.minLevel
+}
+
+// SetLevel implements OutputHandle
+func (lo *logOutput) SetLevel(level LogLevel) {
+	lo.mux.Lock()
+	defer lo.mux.Unlock()
+	lo.minLevel = level
+}
+
+// SetFilter implements OutputHandle
+func (lo *logOutput) SetFilter(filter FilterFunc) {
+	if filter == nil {
+		filter = FilterMatchAll
+	}
+	lo.mux.Lock()
+	defer lo.mux.Unlock()
+	lo.filter = filter
+}
+
+// NamespaceLevels implements OutputHandle
+func (lo *logOutput) NamespaceLevels() NamespaceLevels {
+	lo.mux.RLock()
+	defer lo.mux.RUnlock()
+	return append(NamespaceLevels(nil), lo.nsLevels...)
+}
+
+// SetNamespaceLevels implements OutputHandle
+func (lo *logOutput) SetNamespaceLevels(levels NamespaceLevels) {
+	levels = levels.sorted()
+	lo.mux.Lock()
+	defer lo.mux.Unlock()
+	lo.nsLevels = levels
+}
+
+// Stats implements OutputHandle
+func (lo *logOutput) Stats() OutputStats {
+	lo.mux.RLock()
+	lastErr := lo.lastErr
+	lo.mux.RUnlock()
+	return OutputStats{
+		Written:   atomic.LoadUint64(&lo.written),
+		Dropped:   atomic.LoadUint64(&lo.dropped),
+		Errors:    atomic.LoadUint64(&lo.errors),
+		LastError: lastErr,
+	}
+}
+
+// Remove implements OutputHandle
+func (lo *logOutput) Remove() {
+	if lo.owner != nil {
+		lo.owner.RemoveOutput(lo)
+	}
+}
+
+// Outputs returns handles for all the outputs of the logger, in the order they were added
+func (lgr *AsyncLogger) Outputs() []OutputHandle {
+	outputs := lgr.getOutputs()
+	handles := make([]OutputHandle, 0, len(outputs))
+	for _, output := range outputs {
+		handles = append(handles, output)
+	}
+	return handles
+}
+
+// Output returns the handle of the output with the given name, or nil
+func (lgr *AsyncLogger) Output(name string) OutputHandle {
+	for _, output := range lgr.getOutputs() {
+		if output.name == name {
+			return output
+		}
+	}
+	return nil
+}
+
+// SetOutputTheme sets the theme of the output with the given name, see SimpleFormatter.SetTheme; returns an error if
+// there is no such output or it does not use a simple formatter
+func (lgr *AsyncLogger) SetOutputTheme(name string, theme *Theme) error {
+	output, ok := lgr.Output(name).(*logOutput)
+	if !ok {
+		return fmt.Errorf("unknown log output %q", name)
+	}
+	formatter, ok := output.formatter.(*SimpleFormatter)
+	if !ok {
+		return fmt.Errorf("log output %q does not support themes", name)
+	}
+	return formatter.SetTheme(theme)
+}
+
+// RemoveOutput removes an output from the logger; returns false if it was not found. The messages already queued for
+// the output are written in the background, Flush before to wait for them.
+func (lgr *AsyncLogger) RemoveOutput(handle OutputHandle) bool {
+	lgr.outputsMux.Lock()
+	defer lgr.outputsMux.Unlock()
+
+	for i, output := range lgr.outputs {
+		if OutputHandle(output) == handle {
+			// copy so that snapshots taken by the writer goroutine are not modified
+			outputs := make([]*logOutput, 0, len(lgr.outputs)-1)
+			outputs = append(outputs, lgr.outputs[:i]...)
+			lgr.outputs = append(outputs, lgr.outputs[i+1:]...)
+
+			// the output goroutine writes what is already queued, then stops
+			go output.close()
+			return true
+		}
+	}
+	return false
+}
+
+func (lgr *AsyncLogger) addOutput(output *logOutput) {
+	lgr.outputsMux.Lock()
+	defer lgr.outputsMux.Unlock()
+
+	output.owner = lgr
+	lgr.outputSeq++
+	if output.name == "" {
+		output.name = fmt.Sprintf("output-%d", lgr.outputSeq)
+	}
+	outputs := make([]*logOutput, 0, len(lgr.outputs)+1)
+	outputs = append(outputs, lgr.outputs...)
+	lgr.outputs = append(outputs, output)
+}
+
+// getOutputs returns a snapshot of the outputs; the returned slice is never modified
+func (lgr *AsyncLogger) getOutputs() []*logOutput {
+	lgr.outputsMux.RLock()
+	defer lgr.outputsMux.RUnlock()
+	return lgr.outputs
+}
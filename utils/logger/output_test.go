@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamespaceLevels(t *testing.T) {
+	levels, err := ParseNamespaceLevels("*=info, WS=debug, exch*=warn")
+	require.NoError(t, err)
+	assert.Equal(t, "WS=debug, exch*=warn, *=info", levels.String())
+
+	for ns, expected := range map[string]LogLevel{"WS": LogLevelDebug, "WS2": LogLevelInfo, "exch.binance": LogLevelWarn, "": LogLevelInfo} {
+		level, ok := levels.Lookup(ns)
+		assert.True(t, ok)
+		assert.Equal(t, expected, level, ns)
+	}
+
+	_, err = ParseNamespaceLevels("WS")
+	assert.Error(t, err)
+	_, err = ParseNamespaceLevels("WS=loud")
+	assert.Error(t, err)
+}
+
+func TestOutputHandle(t *testing.T) {
+	// stub the clock
+	currentTime, _ := time.Parse(time.RFC3339Nano, "2020-09-29T19:05:07.123456Z")
+	currentClock = testClock(currentTime)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage)}
+	go testLogger.handleLogs(ctx)
+
+	var first, second bytes.Buffer
+	handle := testLogger.AddOutput(FilterMatchAll, &first, LogLevelInfo, false, true, OutputName("first"))
+	testLogger.AddOutput(FilterMatchAll, &second, LogLevelDebug, false, true)
+	assert.Equal(t, handle, testLogger.Output("first"))
+	assert.Len(t, testLogger.Outputs(), 2)
+
+	testLogger.Debugf("WS", "hidden")
+	levels, _ := ParseNamespaceLevels("WS=debug")
+	handle.SetNamespaceLevels(levels)
+	testLogger.Debugf("WS", "shown")
+	testLogger.Debugf("MD", "hidden")
+
+	handle.SetLevel(LogLevelWarn)
+	handle.SetFilter(Filter("MD"))
+	testLogger.Warnf("WS", "filtered")
+	testLogger.Warnf("MD", "warning")
+
+	// a removed output still writes what is queued, in the background
+	testLogger.Flush()
+	handle.Remove()
+	assert.Nil(t, testLogger.Output("first"))
+	testLogger.Warnf("MD", "removed")
+
+	testLogger.Flush()
+
+	expectedOutput := "2020-09-29 19:05:07.123 (WS) [DEBUG]: shown\n" +
+		"2020-09-29 19:05:07.123 (MD) [WARN]: warning\n"
+	assert.Equal(t, expectedOutput, first.String())
+	assert.Contains(t, second.String(), "removed")
+}
+
+type blockingWriter struct {
+	release chan struct{}
+	waiting chan struct{}
+	buf     bytes.Buffer
+}
+
+func (bw *blockingWriter) Write(p []byte) (int, error) {
+	if bw.waiting != nil {
+		select {
+		case bw.waiting <- struct{}{}:
+		default:
+		}
+	}
+	<-bw.release
+	return bw.buf.Write(p)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestOutputWorkers(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 16)}
+	go testLogger.handleLogs(ctx)
+
+	handled := make(chan error, 3)
+	testLogger.SetWriteErrorHandler(func(output OutputHandle, err error) {
+		handled <- err
+	})
+
+	slow := &blockingWriter{release: make(chan struct{})}
+	var fast bytes.Buffer
+	slowHandle := testLogger.AddOutput(FilterMatchAll, slow, LogLevelDebug, false, true, NewJsonFormatter())
+	fastHandle := testLogger.AddOutput(FilterMatchAll, &fast, LogLevelDebug, false, true, NewJsonFormatter())
+	failingHandle := testLogger.AddOutput(FilterMatchAll, failingWriter{}, LogLevelDebug, false, true)
+
+	for i := 0; i < 3; i++ {
+		testLogger.Infof("test-logger", "message %d", i)
+	}
+
+	// the fast output is written although the slow one is stuck
+	assert.Eventually(t, func() bool {
+		return fastHandle.Stats().Written == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), slowHandle.Stats().Written)
+
+	close(slow.release)
+	testLogger.Flush()
+	assert.Equal(t, uint64(3), slowHandle.Stats().Written)
+	assert.Equal(t, slow.buf.String(), fast.String())
+	assert.Regexp(t, `(?s)message 0.*message 1.*message 2`, slow.buf.String())
+
+	stats := failingHandle.Stats()
+	assert.Equal(t, uint64(3), stats.Errors)
+	assert.EqualError(t, stats.LastError, "disk full")
+	assert.Len(t, handled, 3)
+	assert.EqualError(t, <-handled, "disk full")
+}
+
+func TestOutputQueueDrops(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	// the default policy blocks the callers on a full log buffer, not the writer goroutine on a full output queue
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 16)}
+	go testLogger.handleLogs(ctx)
+
+	slow := &blockingWriter{release: make(chan struct{}), waiting: make(chan struct{}, 1)}
+	handle := testLogger.AddOutput(FilterMatchAll, slow, LogLevelDebug, false, true, OutputQueueSize(1))
+	var fast syncBuffer
+	fastHandle := testLogger.AddOutput(FilterMatchAll, &fast, LogLevelDebug, false, true, OutputQueueSize(1))
+
+	// wait for the first message to be taken from the queue by the output goroutine
+	testLogger.Infof("test-logger", "message 0")
+	<-slow.waiting
+
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			testLogger.Infof("test-logger", "message %d", i)
+		}
+		// the other output keeps receiving messages while the slow one is stuck
+		assert.Eventually(t, func() bool {
+			return fastHandle.Stats().Written == uint64(i+1)
+		}, time.Second, time.Millisecond)
+	}
+	// one message is being written, one is queued, the others are dropped
+	assert.Equal(t, uint64(3), handle.Stats().Dropped)
+	assert.Equal(t, uint64(0), fastHandle.Stats().Dropped)
+	assert.Contains(t, fast.String(), "message 4")
+
+	close(slow.release)
+	testLogger.Flush()
+	assert.Equal(t, uint64(2), handle.Stats().Written)
+}
@@ -0,0 +1,179 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// LogWriteErrorReportInterval limits how often the default write error handler reports errors of an output
+var LogWriteErrorReportInterval = 10 * time.Second
+
+// WriteErrorHandler is called from the goroutine of an output when writing to it fails. It must not block.
+type WriteErrorHandler func(output OutputHandle, err error)
+
+// SetWriteErrorHandler sets the handler called on output write errors. The default handler reports errors to
+// stderr, at most once per LogWriteErrorReportInterval for each output.
+func (lgr *AsyncLogger) SetWriteErrorHandler(handler WriteErrorHandler) {
+	lgr.outputsMux.Lock()
+	defer lgr.outputsMux.Unlock()
+	lgr.writeErrorHandler = handler
+}
+
+func (lgr *AsyncLogger) getWriteErrorHandler() WriteErrorHandler {
+	lgr.outputsMux.RLock()
+	defer lgr.outputsMux.RUnlock()
+	return lgr.writeErrorHandler
+}
+
+// start creates the queue and starts the output goroutine, once
+func (lo *logOutput) start() {
+	lo.startOnce.Do(func() {
+		size := lo.queueSize
+		if size <= 0 {
+			size = LogOutputQueueSize
+		}
+		lo.queue = make(chan logMessage, size)
+		go lo.run()
+	})
+}
+
+// enqueue queues msg for writing. If the queue is full, msg is dropped, unless deadline is set: it then waits for room
+// until deadline, which is only done for FATAL messages.
+func (lo *logOutput) enqueue(msg logMessage, deadline time.Time) {
+	lo.start()
+	lo.queueMux.RLock()
+	defer lo.queueMux.RUnlock()
+
+	if lo.closed {
+		return
+	}
+	select {
+	case lo.queue <- msg:
+		return
+	default:
+	}
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case lo.queue <- msg:
+			return
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&lo.dropped, 1)
+}
+
+// flush waits until everything queued so far has been written
+func (lo *logOutput) flush() {
+	lo.start()
+	flushed := make(chan struct{})
+	lo.queueMux.RLock()
+	closed := lo.closed
+	if !closed {
+		lo.queue <- logMessage{flushed: flushed}
+	}
+	lo.queueMux.RUnlock()
+	if !closed {
+		<-flushed
+	}
+}
+
+// close stops the output goroutine once the queued messages are written
+func (lo *logOutput) close() {
+	lo.start()
+	lo.queueMux.Lock()
+	defer lo.queueMux.Unlock()
+
+	if !lo.closed {
+		lo.closed = true
+		close(lo.queue)
+	}
+}
+
+func (lo *logOutput) run() {
+	if lo.dedup == 0 {
+		for msg := range lo.queue {
+			if msg.flushed != nil {
+				close(msg.flushed)
+				continue
+			}
+			lo.write(msg)
+		}
+		return
+	}
+
+	dedup := newDeduper(time.Duration(lo.dedup))
+	ticker := time.NewTicker(dedup.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-lo.queue:
+			if !ok {
+				lo.writeSummary(dedup)
+				return
+			}
+			if msg.flushed != nil {
+				lo.writeSummary(dedup)
+				close(msg.flushed)
+				continue
+			}
+			for _, m := range dedup.add(msg) {
+				lo.write(m)
+			}
+		case <-ticker.C:
+			lo.writeSummary(dedup)
+		}
+	}
+}
+
+// writeSummary writes the summary of the repeated messages, if any
+func (lo *logOutput) writeSummary(dedup *deduper) {
+	if summary, ok := dedup.summary(); ok {
+		lo.write(summary)
+	}
+}
+
+func (lo *logOutput) write(msg logMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			lo.writeFailed(fmt.Errorf("panic while writing log: %v", r))
+		}
+	}()
+
+	txt := lo.formatter.String(lo.withSourceOf(msg))
+	if lo.dst == defaultScreenDst { // it means screen
+		DefaultScreenOutputFunc(lo.dst, txt)
+	} else if _, err := io.WriteString(lo.dst, txt); err != nil {
+		lo.writeFailed(err)
+		return
+	}
+	atomic.AddUint64(&lo.written, 1)
+}
+
+func (lo *logOutput) writeFailed(err error) {
+	atomic.AddUint64(&lo.errors, 1)
+	lo.mux.Lock()
+	lo.lastErr = err
+	lo.mux.Unlock()
+
+	var handler WriteErrorHandler
+	if lo.owner != nil {
+		handler = lo.owner.getWriteErrorHandler()
+	}
+	if handler != nil {
+		handler(lo, err)
+		return
+	}
+
+	// default: report to stderr, throttled; only the output goroutine gets here, so no locking is needed
+	lo.unreported++
+	if now := time.Now(); now.Sub(lo.lastReported) >= LogWriteErrorReportInterval {
+		fmt.Fprintf(os.Stderr, "log output %s: %d write error(s), last: %v\n", lo.name, lo.unreported, err)
+		lo.lastReported = now
+		lo.unreported = 0
+	}
+}
@@ -0,0 +1,208 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogRecord is a log message parsed back from a formatted log line, see ParseLogLine
+type LogRecord struct {
+	Time      time.Time
+	Level     LogLevel
+	Namespace string
+	Message   string
+	Fields    []Field
+	Caller    Caller
+	Stack     string // JSON format only; with the simple format, the stack stays in the message
+}
+
+// simpleLineRegexp matches lines of the SimpleFormatter; structured fields stay in the message
+var simpleLineRegexp = regexp.MustCompile(`(?s)^(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?) \((.*?)\) \[(DEBUG|INFO|WARN|ERROR|FATAL)\](?: <(.*?)>)?: ?(.*)$`)
+
+// ParseLogLine parses a line written by the simple, JSON, logfmt or GELF formatter back into a LogRecord. With the
+// simple format, the structured fields are left in the message.
+func ParseLogLine(line string) (LogRecord, error) {
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "{"):
+		return parseJSONLine(line)
+	case strings.HasPrefix(line, "time="):
+		return parseLogfmtLine(line)
+	}
+
+	m := simpleLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, fmt.Errorf("unrecognized log line format")
+	}
+	t, err := parseLogTime(m[1])
+	if err != nil {
+		return LogRecord{}, fmt.Errorf("invalid log time: %v", err)
+	}
+	level, _ := lookupLogLevel(m[3])
+	return LogRecord{Time: t, Level: level, Namespace: m[2], Caller: parseCaller(m[4]), Message: m[5]}, nil
+}
+
+func parseJSONLine(line string) (LogRecord, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return LogRecord{}, fmt.Errorf("invalid JSON log line: %v", err)
+	}
+
+	var rec LogRecord
+	var ok bool
+	if _, gelf := doc["short_message"]; gelf {
+		rec.Message, _ = doc["short_message"].(string)
+		rec.Namespace, _ = doc["_namespace"].(string)
+		if ts, err := jsonNumber(doc["timestamp"]).Float64(); err == nil {
+			sec, frac := math.Modf(ts)
+			rec.Time = time.Unix(int64(sec), int64(math.Round(frac*1e3))*1e6).UTC()
+		}
+		severity, _ := jsonNumber(doc["level"]).Int64()
+		rec.Level, ok = logLevelOfSeverity(int(severity))
+		for _, key := range []string{"version", "host", "short_message", "full_message", "timestamp", "level", "_namespace"} {
+			delete(doc, key)
+		}
+		rec.Fields = fieldsFromJSON(doc, func(key string) string {
+			return strings.TrimPrefix(strings.TrimPrefix(key, "_"), "fields.")
+		})
+	} else {
+		rec.Message, _ = doc["message"].(string)
+		rec.Namespace, _ = doc["context"].(string)
+		switch t := doc["time"].(type) {
+		case json.Number:
+			if ns, err := t.Int64(); err == nil {
+				rec.Time = epochTime(ns)
+			}
+		case string:
+			rec.Time, _ = parseLogTime(t)
+		}
+		severity, _ := doc["severity"].(string)
+		rec.Level, ok = lookupLogLevel(severity)
+		if caller, _ := doc["caller"].(string); caller != "" {
+			rec.Caller = parseCaller(caller)
+			rec.Caller.Function, _ = doc["function"].(string)
+		}
+		rec.Stack, _ = doc["stack"].(string)
+		for key := range jsonReservedKeys {
+			delete(doc, key)
+		}
+		rec.Fields = fieldsFromJSON(doc, func(key string) string {
+			return strings.TrimPrefix(key, "fields.")
+		})
+	}
+	if !ok {
+		return LogRecord{}, fmt.Errorf("JSON log line without a valid level")
+	}
+	return rec, nil
+}
+
+func jsonNumber(v interface{}) json.Number {
+	n, _ := v.(json.Number)
+	return n
+}
+
+// fieldsFromJSON returns the remaining keys of a JSON log line as fields, sorted by key
+func fieldsFromJSON(doc map[string]interface{}, rename func(string) string) []Field {
+	if len(doc) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]Field, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, Field{Key: rename(key), Value: doc[key]})
+	}
+	return fields
+}
+
+// logLevelOfSeverity returns the log level of a syslog severity
+func logLevelOfSeverity(severity int) (LogLevel, bool) {
+	switch {
+	case severity < 0:
+		return 0, false
+	case severity <= 2:
+		return LogLevelFatal, true
+	case severity == 3:
+		return LogLevelError, true
+	case severity <= 5:
+		return LogLevelWarn, true
+	case severity == 6:
+		return LogLevelInfo, true
+	case severity == 7:
+		return LogLevelDebug, true
+	}
+	return 0, false
+}
+
+func parseLogfmtLine(line string) (LogRecord, error) {
+	var rec LogRecord
+	var hasLevel bool
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return LogRecord{}, fmt.Errorf("invalid logfmt log line")
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return LogRecord{}, fmt.Errorf("invalid logfmt value of %s: %v", key, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else if end := strings.IndexByte(line, ' '); end >= 0 {
+			value, line = line[:end], line[end:]
+		} else {
+			value, line = line, ""
+		}
+
+		switch key {
+		case "time":
+			t, err := parseLogTime(value)
+			if err != nil {
+				return LogRecord{}, fmt.Errorf("invalid log time: %v", err)
+			}
+			rec.Time = t
+		case "level":
+			rec.Level, hasLevel = lookupLogLevel(value)
+		case "namespace":
+			rec.Namespace = value
+		case "msg":
+			rec.Message = value
+		default:
+			rec.Fields = append(rec.Fields, Field{Key: strings.TrimPrefix(key, "fields."), Value: value})
+		}
+	}
+	if !hasLevel {
+		return LogRecord{}, fmt.Errorf("logfmt log line without a valid level")
+	}
+	return rec, nil
+}
+
+// FormatLogRecord formats a record with f, e.g. to write parsed lines in another format
+func FormatLogRecord(f Formatter, rec LogRecord) string {
+	return f.String(logMessage{
+		level:           rec.Level,
+		namespace:       rec.Namespace,
+		message:         rec.Message,
+		fields:          rec.Fields,
+		unixTimestampNS: rec.Time.UnixNano(),
+		caller:          rec.Caller,
+		stack:           rec.Stack,
+	})
+}
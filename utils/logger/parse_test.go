@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLine(t *testing.T) {
+	rec := LogRecord{
+		Time:      time.Date(2021, 2, 3, 9, 47, 58, 901000000, time.UTC),
+		Level:     LogLevelWarn,
+		Namespace: "order (book)",
+		Message:   "slow update",
+		Fields:    []Field{F("ms", "120"), F("symbol", "BTC USD")},
+	}
+
+	parsed, err := ParseLogLine(FormatLogRecord(NewSimpleFormatter(false, true), rec))
+	require.NoError(t, err)
+	assert.Equal(t, LogRecord{Time: rec.Time, Level: LogLevelWarn, Namespace: "order (book)", Message: `slow update ms=120 symbol="BTC USD"`}, parsed)
+
+	parsed, err = ParseLogLine(FormatLogRecord(NewLogfmtFormatter(true), rec))
+	require.NoError(t, err)
+	assert.Equal(t, rec, parsed)
+
+	parsed, err = ParseLogLine(FormatLogRecord(NewJsonFormatter(), rec))
+	require.NoError(t, err)
+	assert.Equal(t, rec, parsed)
+
+	rec.Fields = []Field{F("ms", json.Number("120"))}
+	parsed, err = ParseLogLine(FormatLogRecord(NewGelfFormatter("host1", false), rec))
+	require.NoError(t, err)
+	assert.Equal(t, rec, parsed)
+
+	_, err = ParseLogLine("just some text")
+	assert.Error(t, err)
+	_, err = ParseLogLine(`{"message": "no level"}`)
+	assert.Error(t, err)
+}
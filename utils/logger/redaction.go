@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LogRedactMask replaces the redacted parts of log messages and field values
+var LogRedactMask = "***"
+
+// LogRedactFieldNames matches the keys of the structured fields whose values are always redacted; it is the default
+// of new loggers, see SetRedactFieldNames
+var LogRedactFieldNames = regexp.MustCompile(`(?i)secret|key|passw|token`)
+
+// MinSecretLength is the length below which RegisterSecret ignores a secret, so that short values do not mask
+// unrelated text
+var MinSecretLength = 6
+
+// secrets registered with RegisterSecret, shared by all loggers
+var secrets = struct {
+	sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}{values: map[string]struct{}{}}
+
+// RegisterSecret registers secret values, like API keys or private keys loaded at runtime, to be masked in the
+// messages and field values of every logger. Values shorter than MinSecretLength are ignored.
+func RegisterSecret(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < MinSecretLength {
+			continue
+		}
+		if _, ok := secrets.values[value]; !ok {
+			secrets.values[value] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// longest first, so that a secret containing another one is masked as a whole
+	sorted := make([]string, 0, len(secrets.values))
+	for value := range secrets.values {
+		sorted = append(sorted, value)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, value := range sorted {
+		oldnew = append(oldnew, value, LogRedactMask)
+	}
+	secrets.replacer = strings.NewReplacer(oldnew...)
+}
+
+// RedactSecrets masks the secrets registered with RegisterSecret in s
+func RedactSecrets(s string) string {
+	secrets.RLock()
+	replacer := secrets.replacer
+	secrets.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// redactor masks secrets in log messages, see AsyncLogger.SetRedactPatterns
+type redactor struct {
+	mux        sync.RWMutex
+	patterns   []*regexp.Regexp
+	fieldNames *regexp.Regexp
+}
+
+// SetRedactPatterns sets the regular expressions masked in log messages and string field values. If a pattern has
+// capturing groups, only the groups are masked, e.g. `(?i)apikey=(\w+)` keeps "apikey=".
+func (lgr *AsyncLogger) SetRedactPatterns(patterns ...*regexp.Regexp) {
+	lgr.redactor.mux.Lock()
+	defer lgr.redactor.mux.Unlock()
+	lgr.redactor.patterns = append([]*regexp.Regexp(nil), patterns...)
+}
+
+// SetRedactFieldNames sets the regular expression matching the keys of the fields whose values are always masked,
+// LogRedactFieldNames by default; nil masks no field as a whole
+func (lgr *AsyncLogger) SetRedactFieldNames(fieldNames *regexp.Regexp) {
+	lgr.redactor.mux.Lock()
+	defer lgr.redactor.mux.Unlock()
+	lgr.redactor.fieldNames = fieldNames
+}
+
+// redact returns msg with the secrets masked in its message and fields. It runs in the writer goroutine before the
+// message is cached or handed over to the outputs, so no formatter sees the secrets.
+func (r *redactor) redact(msg logMessage) logMessage {
+	r.mux.RLock()
+	patterns, fieldNames := r.patterns, r.fieldNames
+	r.mux.RUnlock()
+
+	msg.message = r.redactString(msg.message, patterns)
+	if len(msg.fields) == 0 {
+		return msg
+	}
+
+	// the fields may be shared with a child logger or the caller
+	fields := make([]Field, len(msg.fields))
+	for i, field := range msg.fields {
+		if fieldNames != nil && fieldNames.MatchString(field.Key) {
+			field.Value = LogRedactMask
+		} else {
+			field.Value, _ = r.redactValue(field.Value, patterns, fieldNames, 0)
+		}
+		fields[i] = field
+	}
+	msg.fields = fields
+	return msg
+}
+
+// redactText returns s with the registered secrets and the patterns masked, e.g. for a message leaving the logger
+// before the writer goroutine redacts it
+func (r *redactor) redactText(s string) string {
+	r.mux.RLock()
+	patterns := r.patterns
+	r.mux.RUnlock()
+	return r.redactString(s, patterns)
+}
+
+// maxRedactDepth is the depth of the nested maps and slices redacted in field values
+const maxRedactDepth = 8
+
+// redactValue masks the secrets in string-like values, and in the maps, slices and arrays they are nested in: the
+// values of the map keys matching fieldNames are masked as a whole, like those of the fields. Maps and slices with
+// something masked are copied as map[string]interface{} and []interface{}. Other values, e.g. structs and pointers,
+// are returned as is. Returns true if something was masked.
+func (r *redactor) redactValue(v interface{}, patterns []*regexp.Regexp, fieldNames *regexp.Regexp, depth int) (interface{}, bool) {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return v, false
+	case string:
+		redacted := r.redactString(v, patterns)
+		return redacted, redacted != v
+	case []byte:
+		s = string(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		if depth < maxRedactDepth {
+			return r.redactNested(v, patterns, fieldNames, depth+1)
+		}
+		return v, false
+	}
+	if redacted := r.redactString(s, patterns); redacted != s {
+		return redacted, true
+	}
+	return v, false
+}
+
+func (r *redactor) redactNested(v interface{}, patterns []*regexp.Regexp, fieldNames *regexp.Regexp, depth int) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	masked := false
+	switch rv.Kind() {
+	case reflect.Map:
+		res := make(map[string]interface{}, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			key := fmt.Sprint(iter.Key().Interface())
+			if fieldNames != nil && fieldNames.MatchString(key) {
+				res[key], masked = LogRedactMask, true
+				continue
+			}
+			value, ok := r.redactValue(iter.Value().Interface(), patterns, fieldNames, depth)
+			res[key], masked = value, masked || ok
+		}
+		if masked {
+			return res, true
+		}
+	case reflect.Slice, reflect.Array:
+		res := make([]interface{}, rv.Len())
+		for i := range res {
+			value, ok := r.redactValue(rv.Index(i).Interface(), patterns, fieldNames, depth)
+			res[i], masked = value, masked || ok
+		}
+		if masked {
+			return res, true
+		}
+	}
+	return v, false
+}
+
+func (r *redactor) redactString(s string, patterns []*regexp.Regexp) string {
+	if s == "" {
+		return s
+	}
+	s = RedactSecrets(s)
+	for _, re := range patterns {
+		s = redactPattern(s, re)
+	}
+	return s
+}
+
+// redactPattern masks the matches of re in s, or only their capturing groups if re has any
+func redactPattern(s string, re *regexp.Regexp) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, LogRedactMask)
+	}
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		for i := 2; i+1 < len(match); i += 2 {
+			start, end := match[i], match[i+1]
+			if start < last || start < 0 { // unmatched or nested group
+				continue
+			}
+			sb.WriteString(s[last:start])
+			sb.WriteString(LogRedactMask)
+			last = end
+		}
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
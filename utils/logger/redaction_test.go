@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedaction(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage), cache: newLogCache(10), cacheFormatter: NewSimpleFormatter(false, true),
+		redactor: redactor{fieldNames: LogRedactFieldNames}}
+	go testLogger.handleLogs(ctx)
+
+	var text, json bytes.Buffer
+	testLogger.AddOutput(FilterMatchAll, &text, LogLevelDebug, false, true)
+	testLogger.AddOutput(FilterMatchAll, &json, LogLevelDebug, false, false, NewJsonFormatter())
+	testLogger.SetRedactPatterns(regexp.MustCompile(`(?i)authorization: bearer (\S+)`), regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`))
+
+	RegisterSecret("hmac-secret-0123456789", "short")
+	headers := map[string][]string{"X-Api-Key": {"abc-123"}, "Accept": {"application/json"}}
+	testLogger.With("apiKey", "k-0123").Infow("WS", "sending Authorization: Bearer t0k3n with hmac-secret-0123456789",
+		"Secret", "s3cr3t", "card", "1234-5678-9012-3456", "err", errors.New("bad signature hmac-secret-0123456789"),
+		"short", "short", "headers", headers, "args", []interface{}{1, "hmac-secret-0123456789"})
+	testLogger.Flush()
+
+	for _, out := range []string{text.String(), json.String(), strings.Join(testLogger.cache.snapshot(), "")} {
+		assert.NotContains(t, out, "t0k3n")
+		assert.NotContains(t, out, "hmac-secret")
+		assert.NotContains(t, out, "s3cr3t")
+		assert.NotContains(t, out, "k-0123")
+		assert.NotContains(t, out, "1234-5678")
+		assert.NotContains(t, out, "abc-123")
+		assert.Contains(t, out, "short")
+	}
+	assert.Contains(t, text.String(), "sending Authorization: Bearer *** with ***")
+	assert.Contains(t, text.String(), "apiKey=*** Secret=*** card=*** err=\"bad signature ***\"")
+	assert.Contains(t, text.String(), `headers="map[Accept:[application/json] X-Api-Key:***]" args="[1 ***]"`)
+	assert.Equal(t, []string{"abc-123"}, headers["X-Api-Key"])
+
+	// messages leaving the logger through the error policy are redacted too
+	assert.PanicsWithValue(t, "rejected with ***", func() { testLogger.Errorf("WS", "rejected with hmac-secret-0123456789") })
+	testLogger.SetTestMode(true)
+	testLogger.Errorf("WS", "card 1234-5678-9012-3456")
+	assert.Equal(t, []Failure{{Level: LogLevelError, Namespace: "WS", Message: "card ***"}}, testLogger.Failures())
+	testLogger.SetTestMode(false)
+	testLogger.Flush()
+
+	testLogger.SetRedactFieldNames(nil)
+	testLogger.SetRedactPatterns()
+	text.Reset()
+	testLogger.Infow("WS", "card 1234-5678-9012-3456", "apiKey", "k-0123")
+	testLogger.Flush()
+	require.Contains(t, text.String(), "card 1234-5678-9012-3456 apiKey=k-0123")
+}
+
+func TestRedactPattern(t *testing.T) {
+	re := regexp.MustCompile(`(\w+)=(\w+)`)
+	assert.Equal(t, "***=*** and ***=***", redactPattern("a=1 and b=2", re))
+	assert.Equal(t, "no match", redactPattern("no match", re))
+	assert.Equal(t, "key=*** x", redactPattern("key= x", regexp.MustCompile(`key=(\w*)`)))
+}
@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogSamplingInterval is the default sampling interval, see SamplingOptions
+var LogSamplingInterval = time.Second
+
+// SamplingOptions configures the sampler of a logger, see SetSampling. ERROR and FATAL messages are never sampled
+// or rate limited.
+type SamplingOptions struct {
+	// Interval is the sampling window, and how often the suppressed messages are reported; LogSamplingInterval if 0
+	Interval time.Duration
+
+	// First is the number of messages with the same namespace and format string logged in each interval before
+	// sampling starts; 0 disables sampling
+	First int
+
+	// Thereafter logs every Thereafter-th message once sampling has started; 0 suppresses them all
+	Thereafter int
+
+	// RateLimits limit the rate of messages of each namespace, with a token bucket per namespace
+	RateLimits RateLimits
+}
+
+// RateLimit limits the rate of the messages of each namespace matching Pattern, an exact namespace (its descendants
+// included) or a mask where '*' matches any sequence of characters
+type RateLimit struct {
+	Pattern string
+	Rate    float64 // messages per second
+	Burst   int     // messages logged at once after a quiet period; Rate, at least 1, if 0
+}
+
+// RateLimits is a set of rate limits; for a given namespace, the most specific pattern wins, like with NamespaceLevels
+type RateLimits []RateLimit
+
+// ParseRateLimits parses a spec like "WS=100, exch*=50/200, *=1000" into RateLimits, where a limit is
+// pattern=rate[/burst] in messages per second
+func ParseRateLimits(spec string) (RateLimits, error) {
+	var limits RateLimits
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %q: expected namespace=rate[/burst]", item)
+		}
+		pattern, rawRate := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		rawRate, rawBurst, hasBurst := strings.Cut(rawRate, "/")
+		rate, err := strconv.ParseFloat(rawRate, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: bad rate %q", item, rawRate)
+		}
+		var burst int
+		if hasBurst {
+			if burst, err = strconv.Atoi(rawBurst); err != nil || burst <= 0 {
+				return nil, fmt.Errorf("invalid rate limit %q: bad burst %q", item, rawBurst)
+			}
+		}
+		if pattern == "" {
+			pattern = "*"
+		}
+		limits = append(limits, RateLimit{Pattern: pattern, Rate: rate, Burst: burst})
+	}
+	return limits.sorted(), nil
+}
+
+// Lookup returns the rate limit of the most specific pattern matching namespace
+func (rl RateLimits) Lookup(namespace string) (RateLimit, bool) {
+	// sorted: exact patterns by decreasing length, then masks by decreasing length
+	for _, l := range rl {
+		if matchNamespacePattern(l.Pattern, namespace) {
+			return l, true
+		}
+	}
+	return RateLimit{}, false
+}
+
+func (rl RateLimits) sorted() RateLimits {
+	return sortNamespacePatterns(rl, func(l RateLimit) string { return l.Pattern })
+}
+
+type samplingKey struct {
+	namespace string
+	format    string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   int64 // unix ns of the last refill
+}
+
+// suppressedCount counts the messages of a namespace suppressed in the current interval
+type suppressedCount struct {
+	sampled     uint64
+	rateLimited uint64
+	level       LogLevel // highest level suppressed
+}
+
+// sampler drops messages according to SamplingOptions
+type sampler struct {
+	enabled uint32 // fast path when sampling is off
+
+	mux        sync.Mutex
+	opts       SamplingOptions
+	counts     map[samplingKey]int
+	buckets    map[string]*tokenBucket
+	suppressed map[string]*suppressedCount
+}
+
+// SetSampling enables sampling and rate limiting of the messages. Suppressed messages are counted per namespace and
+// reported at the end of each interval, in their namespace, at the highest level suppressed. A zero SamplingOptions
+// disables sampling.
+func (lgr *AsyncLogger) SetSampling(opts SamplingOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = LogSamplingInterval
+	}
+	opts.RateLimits = opts.RateLimits.sorted()
+
+	s := &lgr.sampler
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.opts = opts
+	s.counts = map[samplingKey]int{}
+	s.buckets = map[string]*tokenBucket{}
+	if s.suppressed == nil {
+		s.suppressed = map[string]*suppressedCount{}
+	}
+	enabled := uint32(0)
+	if opts.First > 0 || len(opts.RateLimits) > 0 {
+		enabled = 1
+	}
+	atomic.StoreUint32(&s.enabled, enabled)
+}
+
+// allow reports whether msg passes the sampler, counting it as suppressed otherwise
+func (s *sampler) allow(msg logMessage) bool {
+	if atomic.LoadUint32(&s.enabled) == 0 || uint(msg.level) >= uint(LogLevelError) {
+		return true
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.opts.First > 0 {
+		key := samplingKey{namespace: msg.namespace, format: msg.format}
+		n := s.counts[key] + 1
+		s.counts[key] = n
+		if n > s.opts.First && (s.opts.Thereafter <= 0 || (n-s.opts.First)%s.opts.Thereafter != 0) {
+			s.suppress(msg).sampled++
+			return false
+		}
+	}
+
+	if limit, ok := s.opts.RateLimits.Lookup(msg.namespace); ok {
+		burst := float64(limit.Burst)
+		if burst <= 0 {
+			// at least a message, or rates below 1 per second would suppress everything
+			burst = math.Max(1, limit.Rate)
+		}
+		bucket := s.buckets[msg.namespace]
+		if bucket == nil {
+			bucket = &tokenBucket{tokens: burst, last: msg.unixTimestampNS}
+			s.buckets[msg.namespace] = bucket
+		}
+		if elapsed := msg.unixTimestampNS - bucket.last; elapsed > 0 {
+			bucket.tokens += float64(elapsed) / 1e9 * limit.Rate
+			if bucket.tokens > burst {
+				bucket.tokens = burst
+			}
+			bucket.last = msg.unixTimestampNS
+		}
+		if bucket.tokens < 1 {
+			s.suppress(msg).rateLimited++
+			return false
+		}
+		bucket.tokens--
+	}
+	return true
+}
+
+func (s *sampler) suppress(msg logMessage) *suppressedCount {
+	count := s.suppressed[msg.namespace]
+	if count == nil {
+		count = &suppressedCount{}
+		s.suppressed[msg.namespace] = count
+	}
+	if uint(msg.level) > uint(count.level) {
+		count.level = msg.level
+	}
+	return count
+}
+
+// endInterval starts a new sampling interval; returns the suppressed counts of the one that ended
+func (s *sampler) endInterval() map[string]*suppressedCount {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if len(s.counts) > 0 {
+		s.counts = map[samplingKey]int{}
+	}
+	suppressed := s.suppressed
+	s.suppressed = map[string]*suppressedCount{}
+	return suppressed
+}
+
+func (s *sampler) interval() time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.opts.Interval <= 0 {
+		return LogSamplingInterval
+	}
+	return s.opts.Interval
+}
+
+// reportSampled ends the sampling intervals and reports the suppressed messages, until ctx is done
+func (lgr *AsyncLogger) reportSampled(ctx context.Context) {
+	for {
+		timer := time.NewTimer(lgr.sampler.interval())
+		select {
+		case <-timer.C:
+			lgr.reportSampledOnce(ctx)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (lgr *AsyncLogger) reportSampledOnce(ctx context.Context) {
+	suppressed := lgr.sampler.endInterval()
+	namespaces := make([]string, 0, len(suppressed))
+	for namespace := range suppressed {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	interval := lgr.sampler.interval()
+	for _, namespace := range namespaces {
+		count := suppressed[namespace]
+		// the report bypasses the sampler, and waits for room in the buffer
+		report := newLogMessageW(count.level, namespace,
+			fmt.Sprintf("suppressed %d log messages in the last %v", count.sampled+count.rateLimited, interval),
+			[]Field{{Key: "sampled", Value: count.sampled}, {Key: "rateLimited", Value: count.rateLimited}})
+		lgr.withLogsNotBlocked(func() {
+			select {
+			case lgr.logs <- report:
+			case <-ctx.Done():
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits("*=1000, WS=100, exch*=50/200")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimits{{"WS", 100, 0}, {"exch*", 50, 200}, {"*", 1000, 0}}, limits)
+
+	limit, ok := limits.Lookup("exch.binance")
+	assert.True(t, ok)
+	assert.Equal(t, 200, limit.Burst)
+	// an exact namespace also limits its descendants, like with NamespaceLevels
+	limit, ok = limits.Lookup("WS.binance")
+	assert.True(t, ok)
+	assert.Equal(t, 100.0, limit.Rate)
+	limit, _ = limits.Lookup("WSS")
+	assert.Equal(t, 1000.0, limit.Rate)
+
+	for _, spec := range []string{"WS", "WS=fast", "WS=0", "WS=10/x"} {
+		_, err = ParseRateLimits(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2020-09-29T19:05:07Z")
+	currentClock = testClock(now)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 100)}
+	testLogger.SetErrorPolicy(ErrorPolicyReturn, nil)
+	var buf bytes.Buffer
+	testLogger.AddOutput(FilterMatchAll, &buf, LogLevelDebug, false, true)
+	go testLogger.handleLogs(ctx)
+
+	testLogger.SetSampling(SamplingOptions{First: 2, Thereafter: 3, Interval: time.Minute})
+	for i := 1; i <= 10; i++ {
+		testLogger.Debugf("WS", "message %d", i)
+		testLogger.Infow("MD", "tick", "i", i)
+	}
+	testLogger.Errorf("WS", "never sampled")
+	testLogger.reportSampledOnce(ctx)
+	testLogger.Debugf("WS", "message %d", 11)
+	testLogger.Flush()
+
+	var logged []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		logged = append(logged, line[strings.Index(line, "("):])
+	}
+	assert.Equal(t, []string{
+		"(WS) [DEBUG]: message 1", "(MD) [INFO]: tick i=1",
+		"(WS) [DEBUG]: message 2", "(MD) [INFO]: tick i=2",
+		"(WS) [DEBUG]: message 5", "(MD) [INFO]: tick i=5",
+		"(WS) [DEBUG]: message 8", "(MD) [INFO]: tick i=8",
+		"(WS) [ERROR]: never sampled",
+		"(MD) [INFO]: suppressed 6 log messages in the last 1m0s sampled=6 rateLimited=0",
+		"(WS) [DEBUG]: suppressed 6 log messages in the last 1m0s sampled=6 rateLimited=0",
+		"(WS) [DEBUG]: message 11",
+	}, logged)
+}
+
+func TestRateLimits(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2020-09-29T19:05:07Z")
+	currentClock = testClock(now)
+	defer resetClock()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 100)}
+	testLogger.SetSampling(SamplingOptions{RateLimits: RateLimits{{Pattern: "WS*", Rate: 2, Burst: 3}}})
+
+	for i := 0; i < 5; i++ {
+		testLogger.Infof("WS1", "message")
+		testLogger.Infof("WS2", "message")
+		testLogger.Infof("MD", "message")
+	}
+	currentClock = testClock(now.Add(time.Second))
+	for i := 0; i < 5; i++ {
+		testLogger.Infof("WS1", "message")
+	}
+	assert.Len(t, testLogger.logs, 3+3+5+2)
+
+	suppressed := testLogger.sampler.endInterval()
+	require.Len(t, suppressed, 2)
+	assert.Equal(t, suppressedCount{rateLimited: 5, level: LogLevelInfo}, *suppressed["WS1"])
+	assert.Equal(t, suppressedCount{rateLimited: 2, level: LogLevelInfo}, *suppressed["WS2"])
+
+	testLogger.SetSampling(SamplingOptions{})
+	testLogger.Infof("WS1", "message")
+	assert.Len(t, testLogger.logs, 14)
+}
+
+func TestRateLimitsBelowOne(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2020-09-29T19:05:07Z")
+	currentClock = testClock(now)
+	defer resetClock()
+
+	limits, err := ParseRateLimits("WS=0.5")
+	require.NoError(t, err)
+	testLogger := &AsyncLogger{logs: make(chan logMessage, 100)}
+	testLogger.SetSampling(SamplingOptions{RateLimits: limits})
+
+	// a message every 2 seconds
+	testLogger.Infof("WS", "message")
+	testLogger.Infof("WS", "message")
+	currentClock = testClock(now.Add(time.Second))
+	testLogger.Infof("WS", "message")
+	currentClock = testClock(now.Add(2 * time.Second))
+	testLogger.Infof("WS", "message")
+	assert.Len(t, testLogger.logs, 2)
+}
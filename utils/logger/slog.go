@@ -0,0 +1,290 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// SlogNamespaceSeparator joins the handler namespace and slog group names into the namespace of a message
+var SlogNamespaceSeparator = "."
+
+// SlogNamespaceKey is the attribute key holding the namespace of messages logged through a Logger from NewSlogLogger
+var SlogNamespaceKey = "namespace"
+
+// SlogLevelFatal is the slog level of FATAL messages logged through a Logger from NewSlogLogger
+const SlogLevelFatal = slog.LevelError + 4
+
+// fieldLogger is implemented by the loggers of this package to log a message without the side effects of the
+// Errorf/Errorw methods (panic)
+type fieldLogger interface {
+	logFields(level LogLevel, namespace, msg string, fields []Field)
+}
+
+func (lgr *AsyncLogger) logFields(level LogLevel, namespace, msg string, fields []Field) {
+	lgr.log(newLogMessageW(level, namespace, msg, fields))
+}
+
+func (cl *childLogger) logFields(level LogLevel, namespace, msg string, fields []Field) {
+	cl.parent.log(newLogMessageW(level, JoinNamespace(cl.namespace, namespace), msg, appendFields(cl.fields, fields)))
+}
+
+// SlogHandler is a slog.Handler writing to a Logger. Groups opened with WithGroup are appended to the namespace,
+// e.g. "app.db"; attributes become structured fields, with group attributes flattened into dotted keys
+// ("request.method"). slog levels map to the closest LogLevel; records above slog.LevelError are logged as ERROR,
+// never FATAL, and never panic.
+type SlogHandler struct {
+	lgr       Logger
+	namespace string
+	minLevel  LogLevel
+	fields    []Field
+	prefix    string // key prefix of the attributes of groups opened after the first WithAttrs
+}
+
+// NewSlogHandler creates a slog.Handler logging to lgr in namespace, for levels starting at minLevel. Use it to
+// capture the logs of libraries using log/slog:
+//
+//	slog.SetDefault(slog.New(logger.NewSlogHandler(lgr, "slog", logger.LogLevelInfo)))
+func NewSlogHandler(lgr Logger, namespace string, minLevel LogLevel) *SlogHandler {
+	return &SlogHandler{lgr: lgr, namespace: namespace, minLevel: minLevel}
+}
+
+// Enabled implements slog.Handler
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return uint(LogLevelFromSlog(level)) >= uint(h.minLevel)
+}
+
+// Handle implements slog.Handler
+func (h *SlogHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := append([]Field(nil), h.fields...)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	level := LogLevelFromSlog(record.Level)
+	if fl, ok := h.lgr.(fieldLogger); ok {
+		fl.logFields(level, h.namespace, record.Message, fields)
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		args = append(args, field)
+	}
+	switch level {
+	case LogLevelDebug:
+		h.lgr.Debugw(h.namespace, record.Message, args...)
+	case LogLevelInfo:
+		h.lgr.Infow(h.namespace, record.Message, args...)
+	case LogLevelWarn:
+		h.lgr.Warnw(h.namespace, record.Message, args...)
+	default:
+		h.errorw(record.Message, args)
+	}
+	return nil
+}
+
+// errorw logs through Errorw, which may panic, and recovers: a slog call must not panic
+func (h *SlogHandler) errorw(msg string, args []interface{}) {
+	defer func() {
+		_ = recover()
+	}()
+	h.lgr.Errorw(h.namespace, msg, args...)
+}
+
+// WithAttrs implements slog.Handler
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	res := *h
+	res.fields = append([]Field(nil), h.fields...)
+	for _, attr := range attrs {
+		res.fields = appendSlogAttr(res.fields, h.prefix, attr)
+	}
+	return &res
+}
+
+// WithGroup implements slog.Handler. Until attributes are added, a group extends the namespace; after that, it
+// prefixes the keys of the attributes that follow, so they are not confused with the ones already added.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	if len(h.fields) == 0 && h.prefix == "" {
+		if res.namespace == "" {
+			res.namespace = name
+		} else {
+			res.namespace = h.namespace + SlogNamespaceSeparator + name
+		}
+	} else {
+		res.prefix = h.prefix + name + "."
+	}
+	return &res
+}
+
+// appendSlogAttr appends attr to fields, flattening groups into dotted keys
+func appendSlogAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			fields = appendSlogAttr(fields, prefix, groupAttr)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + attr.Key, Value: attr.Value.Any()})
+}
+
+// LogLevelFromSlog returns the LogLevel of a slog level; levels above slog.LevelError map to LogLevelError
+func LogLevelFromSlog(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LogLevelDebug
+	case level < slog.LevelWarn:
+		return LogLevelInfo
+	case level < slog.LevelError:
+		return LogLevelWarn
+	}
+	return LogLevelError
+}
+
+// SlogLevel returns the slog level of a LogLevel
+func SlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	}
+	return SlogLevelFatal
+}
+
+// slogLogger is a Logger writing to a slog.Logger, see NewSlogLogger
+type slogLogger struct {
+	lgr       *slog.Logger
+	namespace string // see Named
+}
+
+// NewSlogLogger returns a Logger writing to lgr, for code written against Logger in an application logging with
+// log/slog. The namespace is added as the SlogNamespaceKey attribute. Errorf/Errorw panic and Fatalf/Fatalw exit the
+// process, like with AsyncLogger. Outputs can't be added: AddOutput returns nil.
+func NewSlogLogger(lgr *slog.Logger) Logger {
+	return &slogLogger{lgr: lgr}
+}
+
+func (sl *slogLogger) logw(level LogLevel, namespace, msg string, keysAndValues []interface{}) {
+	fields := fieldsFromArgs(keysAndValues)
+	attrs := make([]slog.Attr, 0, len(fields)+1)
+	attrs = append(attrs, slog.String(SlogNamespaceKey, JoinNamespace(sl.namespace, namespace)))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+	sl.lgr.LogAttrs(context.Background(), SlogLevel(level), msg, attrs...)
+}
+
+// Debugf implements Logger
+func (sl *slogLogger) Debugf(namespace, format string, a ...interface{}) {
+	sl.logw(LogLevelDebug, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Infof implements Logger
+func (sl *slogLogger) Infof(namespace, format string, a ...interface{}) {
+	sl.logw(LogLevelInfo, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Warnf implements Logger
+func (sl *slogLogger) Warnf(namespace, format string, a ...interface{}) {
+	sl.logw(LogLevelWarn, namespace, fmt.Sprintf(format, a...), nil)
+}
+
+// Errorf implements Logger
+// Will trigger panic in the calling goroutine
+func (sl *slogLogger) Errorf(namespace, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	sl.logw(LogLevelError, namespace, message, nil)
+	panic(message)
+}
+
+// Fatalf implements Logger
+// Will terminate the process
+func (sl *slogLogger) Fatalf(namespace, format string, a ...interface{}) {
+	sl.logw(LogLevelFatal, namespace, fmt.Sprintf(format, a...), nil)
+	os.Exit(1)
+}
+
+// Debugw implements Logger
+func (sl *slogLogger) Debugw(namespace, msg string, keysAndValues ...interface{}) {
+	sl.logw(LogLevelDebug, namespace, msg, keysAndValues)
+}
+
+// Infow implements Logger
+func (sl *slogLogger) Infow(namespace, msg string, keysAndValues ...interface{}) {
+	sl.logw(LogLevelInfo, namespace, msg, keysAndValues)
+}
+
+// Warnw implements Logger
+func (sl *slogLogger) Warnw(namespace, msg string, keysAndValues ...interface{}) {
+	sl.logw(LogLevelWarn, namespace, msg, keysAndValues)
+}
+
+// Errorw implements Logger
+// Will trigger panic in the calling goroutine
+func (sl *slogLogger) Errorw(namespace, msg string, keysAndValues ...interface{}) {
+	sl.logw(LogLevelError, namespace, msg, keysAndValues)
+	panic(msg)
+}
+
+// Fatalw implements Logger
+// Will terminate the process
+func (sl *slogLogger) Fatalw(namespace, msg string, keysAndValues ...interface{}) {
+	sl.logw(LogLevelFatal, namespace, msg, keysAndValues)
+	os.Exit(1)
+}
+
+// With implements Logger
+func (sl *slogLogger) With(keysAndValues ...interface{}) Logger {
+	fields := fieldsFromArgs(keysAndValues)
+	args := make([]any, 0, len(fields))
+	for _, field := range fields {
+		args = append(args, slog.Any(field.Key, field.Value))
+	}
+	return &slogLogger{lgr: sl.lgr.With(args...), namespace: sl.namespace}
+}
+
+// Named implements Logger
+func (sl *slogLogger) Named(name string) Logger {
+	return &slogLogger{lgr: sl.lgr, namespace: JoinNamespace(sl.namespace, name)}
+}
+
+// AddOutput implements Logger; outputs of a slog.Logger are configured on its handler, so this does nothing
+func (sl *slogLogger) AddOutput(filter FilterFunc, output io.Writer, minLevel LogLevel, ansi bool, trailCR bool, opts ...interface{}) OutputHandle {
+	return nil
+}
+
+// Flush implements Logger; slog handlers write synchronously
+func (sl *slogLogger) Flush() {
+}
+
+// NewLine implements Logger; does nothing
+func (sl *slogLogger) NewLine() {
+}
+
+// NoDateNextLine implements Logger; does nothing
+func (sl *slogLogger) NoDateNextLine() {
+}
@@ -0,0 +1,75 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	// stub the clock
+	currentTime, _ := time.Parse(time.RFC3339Nano, "2020-09-29T19:05:07.123456Z")
+	currentClock = testClock(currentTime)
+	defer resetClock()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	var capturedOutput bytes.Buffer
+	testLogger := &AsyncLogger{logs: make(chan logMessage)}
+	testLogger.AddOutput(FilterMatchAll, &capturedOutput, LogLevelDebug, false, true)
+	go testLogger.handleLogs(ctx)
+
+	slogger := slog.New(NewSlogHandler(testLogger, "lib", LogLevelInfo))
+	slogger.Debug("not logged")
+	slogger.Info("connected", "host", "db1", slog.Group("pool", slog.Int("size", 4)))
+	slogger.WithGroup("db").With("table", "orders").WithGroup("query").Warn("slow query", "ms", 120)
+	// must not panic
+	slogger.Error("failed", "err", "timeout")
+	slogger.Log(context.Background(), slog.LevelError+8, "very bad")
+
+	testLogger.Flush()
+	expectedOutput := "2020-09-29 19:05:07.123 (lib) [INFO]: connected host=db1 pool.size=4\n" +
+		"2020-09-29 19:05:07.123 (lib.db) [WARN]: slow query table=orders query.ms=120\n" +
+		"2020-09-29 19:05:07.123 (lib) [ERROR]: failed err=timeout\n" +
+		"2020-09-29 19:05:07.123 (lib) [ERROR]: very bad\n"
+	assert.Equal(t, expectedOutput, capturedOutput.String())
+}
+
+func TestSlogLogger(t *testing.T) {
+	var capturedOutput bytes.Buffer
+	handler := slog.NewTextHandler(&capturedOutput, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	lgr := NewSlogLogger(slog.New(handler))
+
+	lgr.Debugf("WS", "connecting to %s", "binance")
+	lgr.With("exchange", "binance").Infow("WS", "order sent", "orderId", 42, F("side", "buy"))
+	assert.Panics(t, func() { lgr.Errorf("WS", "disconnected") })
+
+	expectedOutput := "level=DEBUG msg=\"connecting to binance\" namespace=WS\n" +
+		"level=INFO msg=\"order sent\" exchange=binance namespace=WS orderId=42 side=buy\n" +
+		"level=ERROR msg=disconnected namespace=WS\n"
+	assert.Equal(t, expectedOutput, capturedOutput.String())
+}
+
+func TestSlogLevels(t *testing.T) {
+	for _, level := range []LogLevel{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError} {
+		assert.Equal(t, level, LogLevelFromSlog(SlogLevel(level)))
+	}
+	assert.Equal(t, LogLevel(LogLevelError), LogLevelFromSlog(SlogLevel(LogLevelFatal)))
+	assert.Equal(t, LogLevel(LogLevelDebug), LogLevelFromSlog(slog.LevelDebug-4))
+	assert.Equal(t, LogLevel(LogLevelInfo), LogLevelFromSlog(slog.LevelInfo+2))
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// SourceInfo is an AddOutput option, and a setting of OutputHandle, selecting the source information written with
+// each message. Capturing it costs a stack walk in the calling goroutine, done only while an output asks for it.
+type SourceInfo uint32
+
+const (
+	// SourceCaller writes the file:line and function that logged the message
+	SourceCaller SourceInfo = 1 << iota
+
+	// SourceStack writes the stack of the logging goroutine with messages at LogStackLevel and above
+	SourceStack
+
+	// SourceNone writes no source information (default)
+	SourceNone SourceInfo = 0
+)
+
+// LogStackLevel is the level starting at which SourceStack captures the stack
+var LogStackLevel = LogLevelError
+
+// LogStackDepth is the maximum number of frames of a captured stack
+var LogStackDepth = 32
+
+// Caller is the source location of a log call
+type Caller struct {
+	File     string // path trimmed to the file and its directory, e.g. "logger/source.go"
+	Line     int
+	Function string // function name trimmed to the package, e.g. "logger.(*AsyncLogger).Infof"
+}
+
+// String returns the location as "file:line", or "" if unknown
+func (c Caller) String() string {
+	if c.File == "" {
+		return ""
+	}
+	return c.File + ":" + strconv.Itoa(c.Line)
+}
+
+// parseCaller parses "file:line function", as written by SimpleFormatter
+func parseCaller(raw string) Caller {
+	location, function, _ := strings.Cut(raw, " ")
+	n := strings.LastIndexByte(location, ':')
+	if n < 0 {
+		return Caller{}
+	}
+	line, err := strconv.Atoi(location[n+1:])
+	if err != nil {
+		return Caller{}
+	}
+	return Caller{File: location[:n], Line: line, Function: function}
+}
+
+// loggerPackagePrefix prefixes the names of the functions of this package, skipped when looking for the caller
+var loggerPackagePrefix = func() string {
+	name := runtime.FuncForPC(reflect.ValueOf(ParseLogLevel).Pointer()).Name()
+	return name[:strings.LastIndexByte(name, '.')+1]
+}()
+
+// isLoggingFrame reports whether frame belongs to the logger (this package or log/slog) rather than its caller
+func isLoggingFrame(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	return strings.HasPrefix(frame.Function, loggerPackagePrefix) || strings.HasPrefix(frame.Function, "log/slog.")
+}
+
+// SetSourceInfo implements OutputHandle
+func (lo *logOutput) SetSourceInfo(info SourceInfo) {
+	atomic.StoreUint32(&lo.sourceInfo, uint32(info))
+}
+
+// SourceInfo implements OutputHandle
+func (lo *logOutput) SourceInfo() SourceInfo {
+	return SourceInfo(atomic.LoadUint32(&lo.sourceInfo))
+}
+
+// sourceInfo returns the source information requested by any of the outputs
+func (lgr *AsyncLogger) sourceInfo() SourceInfo {
+	var info SourceInfo
+	for _, output := range lgr.getOutputs() {
+		info |= output.SourceInfo()
+	}
+	return info
+}
+
+// withSource captures the caller and the stack of msg, as requested by the outputs. Called in the logging goroutine.
+func (lgr *AsyncLogger) withSource(msg logMessage) logMessage {
+	info := lgr.sourceInfo()
+	wantStack := info&SourceStack != 0 && uint(msg.level) >= uint(LogStackLevel)
+	if info&SourceCaller == 0 && !wantStack {
+		return msg
+	}
+
+	pcs := make([]uintptr, LogStackDepth+8)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var stack strings.Builder
+	depth := 0
+	for {
+		frame, more := frames.Next()
+		if depth == 0 && isLoggingFrame(frame) {
+			if !more {
+				break
+			}
+			continue
+		}
+		if depth == 0 {
+			msg.caller = Caller{File: trimPath(frame.File), Line: frame.Line, Function: trimFunction(frame.Function)}
+			if !wantStack {
+				break
+			}
+		}
+		if depth > 0 {
+			stack.WriteByte('\n')
+		}
+		stack.WriteString(frame.Function)
+		stack.WriteString("\n\t")
+		stack.WriteString(frame.File)
+		stack.WriteByte(':')
+		stack.WriteString(strconv.Itoa(frame.Line))
+		depth++
+		if !more || depth >= LogStackDepth {
+			break
+		}
+	}
+	msg.stack = stack.String()
+	return msg
+}
+
+// withSourceOf returns msg without the source information the output does not write
+func (lo *logOutput) withSourceOf(msg logMessage) logMessage {
+	info := lo.SourceInfo()
+	if info&SourceCaller == 0 {
+		msg.caller = Caller{}
+	}
+	if info&SourceStack == 0 {
+		msg.stack = ""
+	}
+	return msg
+}
+
+// trimPath keeps the file name and its directory
+func trimPath(file string) string {
+	n := strings.LastIndexByte(file, '/')
+	if n < 0 {
+		return file
+	}
+	if n = strings.LastIndexByte(file[:n], '/'); n < 0 {
+		return file
+	}
+	return file[n+1:]
+}
+
+// trimFunction removes the package path from a function name, like GetFunctionName in package utils
+func trimFunction(function string) string {
+	if n := strings.LastIndexByte(function, '/'); n >= 0 {
+		return function[n+1:]
+	}
+	return function
+}
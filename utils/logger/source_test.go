@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceInfo(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	testLogger := &AsyncLogger{logs: make(chan logMessage)}
+	testLogger.SetErrorPolicy(ErrorPolicyReturn, nil)
+	go testLogger.handleLogs(ctx)
+
+	var plain, caller, stack bytes.Buffer
+	testLogger.AddOutput(FilterMatchAll, &plain, LogLevelDebug, false, true)
+	testLogger.AddOutput(FilterMatchAll, &caller, LogLevelDebug, false, true, SourceCaller)
+	stackHandle := testLogger.AddOutput(FilterMatchAll, &stack, LogLevelDebug, false, false, SourceStack|SourceCaller, NewJsonFormatter())
+
+	testLogger.Infof("WS", "connected")
+	testLogger.With("id", 1).Errorw("WS", "disconnected")
+	testLogger.Flush()
+
+	assert.NotContains(t, plain.String(), "source_test.go")
+	lines := strings.Split(strings.TrimSpace(caller.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^\S+ \S+ \(WS\) \[INFO\] <logger/source_test.go:\d+ logger.TestSourceInfo>: connected$`, lines[0])
+	assert.Regexp(t, `\[ERROR\] <logger/source_test.go:\d+ logger.TestSourceInfo>: disconnected id=1$`, lines[1])
+
+	records := strings.Split(strings.TrimSuffix(stack.String(), "}"), "}{")
+	require.Len(t, records, 2)
+	var info, failure map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(records[0]+"}"), &info))
+	require.NoError(t, json.Unmarshal([]byte("{"+records[1]+"}"), &failure))
+	assert.Nil(t, info["stack"])
+	assert.Equal(t, "logger.TestSourceInfo", failure["function"])
+	assert.True(t, strings.HasPrefix(failure["stack"].(string), "github.com/andrewelkin/trilib/utils/logger.TestSourceInfo\n\t"), failure["stack"])
+
+	rec, err := ParseLogLine(lines[0])
+	require.NoError(t, err)
+	assert.Equal(t, "logger/source_test.go", rec.Caller.File)
+	assert.Equal(t, "logger.TestSourceInfo", rec.Caller.Function)
+	assert.Equal(t, "connected", rec.Message)
+
+	// no capture once no output asks for it
+	stackHandle.SetSourceInfo(SourceNone)
+	testLogger.Output("output-2").SetSourceInfo(SourceNone)
+	assert.Equal(t, SourceNone, testLogger.sourceInfo())
+	assert.Equal(t, Caller{}, testLogger.withSource(logMessage{level: LogLevelError}).caller)
+}
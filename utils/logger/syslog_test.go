@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogFormatter(t *testing.T) {
+	lm := logMessage{
+		level:           LogLevelWarn,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "order book",
+		message:         "{red}slow update{reset}",
+		fields:          []Field{F("ms", 120), F("symbol", `BTC"USD]`)},
+	}
+	pid := strconv.Itoa(os.Getpid())
+
+	f := NewSyslogFormatter(SyslogRFC5424, 16, "host1", "trader", false)
+	assert.Equal(t, `<132>1 2021-02-03T09:47:58.901234Z host1 trader `+pid+` order_book [fields@32473 ms="120" symbol="BTC\"USD\]"] slow update`,
+		f.String(lm))
+
+	lm.fields = nil
+	assert.Equal(t, `<132>1 2021-02-03T09:47:58.901234Z host1 trader `+pid+` order_book - slow update`, f.String(lm))
+
+	f = NewSyslogFormatter(SyslogRFC3164, 1, "host1", "trader", true)
+	lm.fields = []Field{F("ms", 120)}
+	assert.Equal(t, "<12>Feb  3 09:47:58 host1 trader["+pid+"]: (order book) slow update ms=120\n", f.String(lm))
+
+	facility, err := ParseSyslogFacility("LOCAL3")
+	assert.NoError(t, err)
+	assert.Equal(t, 19, facility)
+	_, err = ParseSyslogFacility("local9")
+	assert.Error(t, err)
+}
+
+func TestSyslogWriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sw, err := NewSyslogWriter("udp", conn.LocalAddr().String(), SyslogWriterOptions{})
+	require.NoError(t, err)
+	defer sw.Close()
+
+	_, err = sw.Write([]byte("<14>1 - - - - - - hello\n"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "<14>1 - - - - - - hello", string(buf[:n]))
+}
+
+func TestSyslogWriterUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sw, err := NewSyslogWriter("unix", path, SyslogWriterOptions{})
+	require.NoError(t, err)
+	defer sw.Close()
+
+	_, err = sw.Write([]byte("<14>hello"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "<14>hello", string(buf[:n]))
+}
+
+func TestSyslogWriterTCPReconnect(t *testing.T) {
+	// reserve a port, and keep the server down for now
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	sw, err := NewSyslogWriter("tcp", address, SyslogWriterOptions{BufferSize: 2, ReconnectInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer sw.Close()
+
+	for _, msg := range []string{"one", "two", "three"} {
+		_, err = sw.Write([]byte(msg + "\n"))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, uint64(1), sw.Dropped())
+
+	listener, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	time.Sleep(2 * time.Millisecond)
+	// the buffer is full: "two" is dropped to make room for "four"
+	_, err = sw.Write([]byte("four\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), sw.Dropped())
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	var received string
+	for len(received) < len("5 three4 four") {
+		b, err := reader.ReadByte()
+		require.NoError(t, err)
+		received += string(b)
+	}
+	assert.Equal(t, "5 three4 four", received)
+}
@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogWriter implements io.Writer and sends each write as a syslog message to a syslog server or relay, over UDP,
+// TCP (with RFC 6587 octet-counting framing) or a unix datagram socket. It is meant to be used with a
+// SyslogFormatter, which produces the syslog header.
+//
+// When the connection fails, messages are buffered (up to SyslogWriterOptions.BufferSize, dropping the oldest) and the
+// writer reconnects on the next writes, at most once per ReconnectInterval; the buffer is sent first once connected.
+type SyslogWriter struct {
+	mux sync.Mutex
+
+	network string
+	address string
+	opts    SyslogWriterOptions
+
+	conn          net.Conn
+	lastDial      time.Time
+	buffer        [][]byte
+	droppedCount  uint64
+	framedNetwork bool // stream network, messages are octet-counted
+}
+
+// SyslogWriterOptions configures a SyslogWriter
+type SyslogWriterOptions struct {
+	// BufferSize is the number of messages kept while disconnected; 0 means 1000
+	BufferSize int
+
+	// ReconnectInterval is the minimum time between connection attempts; 0 means 1s
+	ReconnectInterval time.Duration
+
+	// Timeout is the dial and write timeout; 0 means 5s
+	Timeout time.Duration
+}
+
+// syslogLocalSockets are the usual paths of the local syslog socket
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// NewSyslogWriter creates a syslog writer. network is "udp", "tcp", "unixgram" (or "unix"); with an empty address,
+// the unix networks use the local syslog socket (/dev/log). The writer starts even if the server can't be reached yet.
+func NewSyslogWriter(network, address string, opts SyslogWriterOptions) (*SyslogWriter, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1000
+	}
+	if opts.ReconnectInterval <= 0 {
+		opts.ReconnectInterval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	sw := &SyslogWriter{network: network, address: address, opts: opts}
+	switch network {
+	case "unixgram":
+	case "unix":
+		sw.network = "unixgram"
+	case "udp", "udp4", "udp6":
+		if address == "" {
+			return nil, fmt.Errorf("syslog address is required with network %s", network)
+		}
+	case "tcp", "tcp4", "tcp6":
+		if address == "" {
+			return nil, fmt.Errorf("syslog address is required with network %s", network)
+		}
+		sw.framedNetwork = true
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", network)
+	}
+
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+	_ = sw.connect()
+	return sw, nil
+}
+
+// Write implements io.Writer. It returns an error if the message could not be sent; the message is then buffered.
+func (sw *SyslogWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && (p[len(p)-1] == '\n' || p[len(p)-1] == '\r') {
+		p = p[:len(p)-1]
+	}
+	msg := append([]byte(nil), p...)
+
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	sw.buffer = append(sw.buffer, msg)
+	if len(sw.buffer) > sw.opts.BufferSize {
+		sw.droppedCount += uint64(len(sw.buffer) - sw.opts.BufferSize)
+		sw.buffer = sw.buffer[len(sw.buffer)-sw.opts.BufferSize:]
+	}
+	if err := sw.sendBuffer(); err != nil {
+		return n, fmt.Errorf("syslog %s %s: %v (%d messages buffered)", sw.network, sw.address, err, len(sw.buffer))
+	}
+	return n, nil
+}
+
+// Dropped returns the number of messages dropped because the buffer was full
+func (sw *SyslogWriter) Dropped() uint64 {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+	return sw.droppedCount
+}
+
+// Close closes the connection; buffered messages are lost
+func (sw *SyslogWriter) Close() error {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+	if sw.conn == nil {
+		return nil
+	}
+	err := sw.conn.Close()
+	sw.conn = nil
+	return err
+}
+
+// sendBuffer sends the buffered messages, oldest first, connecting if needed
+func (sw *SyslogWriter) sendBuffer() error {
+	if sw.conn == nil {
+		if time.Since(sw.lastDial) < sw.opts.ReconnectInterval {
+			return fmt.Errorf("not connected")
+		}
+		if err := sw.connect(); err != nil {
+			return err
+		}
+	}
+	for len(sw.buffer) > 0 {
+		if err := sw.send(sw.buffer[0]); err != nil {
+			sw.conn.Close()
+			sw.conn = nil
+			return err
+		}
+		sw.buffer[0] = nil
+		sw.buffer = sw.buffer[1:]
+	}
+	return nil
+}
+
+func (sw *SyslogWriter) send(msg []byte) error {
+	if sw.framedNetwork {
+		msg = append(append([]byte(strconv.Itoa(len(msg))), ' '), msg...)
+	}
+	_ = sw.conn.SetWriteDeadline(time.Now().Add(sw.opts.Timeout))
+	_, err := sw.conn.Write(msg)
+	return err
+}
+
+func (sw *SyslogWriter) connect() error {
+	sw.lastDial = time.Now()
+	if sw.address != "" {
+		conn, err := net.DialTimeout(sw.network, sw.address, sw.opts.Timeout)
+		if err != nil {
+			return err
+		}
+		sw.conn = conn
+		return nil
+	}
+
+	var err error
+	for _, path := range syslogLocalSockets {
+		var conn net.Conn
+		if conn, err = net.DialTimeout(sw.network, path, sw.opts.Timeout); err == nil {
+			sw.conn = conn
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mgutz/ansi"
+)
+
+// Theme colors the messages of the simple format on outputs with ansi support: the level tag by level, the namespace
+// with a color picked by a stable hash of the namespace, and the parts of the messages matching highlight rules.
+// Colors are specs like those of the inline markup, e.g. "red", "yellow+b", "white+h:red" or "208" (see
+// github.com/mgutz/ansi); inline markup like "{red}" in the messages works with any theme.
+type Theme struct {
+	Name       string
+	Levels     map[LogLevel]string // color of the level tag; none if missing
+	Namespaces []string            // palette of the namespaces; none if empty
+	Highlights []Highlight         // applied in order to the message and fields; the first matching rule wins
+}
+
+// Highlight colors the parts of the messages and fields matching Pattern
+type Highlight struct {
+	Pattern *regexp.Regexp
+	Color   string
+}
+
+var (
+	// ThemeNone colors nothing but the inline markup
+	ThemeNone = &Theme{Name: "none"}
+
+	// ThemeDark is for terminals with a dark background
+	ThemeDark = &Theme{
+		Name: "dark",
+		Levels: map[LogLevel]string{
+			LogLevelDebug: "black+h",
+			LogLevelInfo:  "green",
+			LogLevelWarn:  "yellow+h",
+			LogLevelError: "red+h",
+			LogLevelFatal: "white+b:red",
+		},
+		Namespaces: []string{"cyan", "magenta", "blue+h", "green+h", "cyan+h", "magenta+h", "yellow", "white+h"},
+	}
+
+	// ThemeLight is for terminals with a light background
+	ThemeLight = &Theme{
+		Name: "light",
+		Levels: map[LogLevel]string{
+			LogLevelDebug: "black+h",
+			LogLevelInfo:  "green",
+			LogLevelWarn:  "magenta+b",
+			LogLevelError: "red+b",
+			LogLevelFatal: "white+b:red",
+		},
+		Namespaces: []string{"blue", "magenta", "cyan", "green", "blue+b", "magenta+b", "cyan+b", "black+b"},
+	}
+)
+
+// themes are the themes of ThemeByName
+var themes = []*Theme{ThemeNone, ThemeDark, ThemeLight}
+
+// ThemeByName returns a copy of the theme named "dark", "light" or "none" (or "")
+func ThemeByName(name string) (*Theme, error) {
+	if name == "" {
+		name = ThemeNone.Name
+	}
+	for _, theme := range themes {
+		if strings.EqualFold(theme.Name, name) {
+			return theme.Clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown log theme %q", name)
+}
+
+// Clone returns a copy of t that can be modified without changing t
+func (t *Theme) Clone() *Theme {
+	clone := &Theme{
+		Name:       t.Name,
+		Levels:     make(map[LogLevel]string, len(t.Levels)),
+		Namespaces: append([]string(nil), t.Namespaces...),
+		Highlights: append([]Highlight(nil), t.Highlights...),
+	}
+	for level, color := range t.Levels {
+		clone.Levels[level] = color
+	}
+	return clone
+}
+
+// Validate returns an error if a color of t is not a valid color spec
+func (t *Theme) Validate() error {
+	for level, color := range t.Levels {
+		if !isColorSpec(color) {
+			return fmt.Errorf("invalid color %q of level %s", color, logLevels[level])
+		}
+	}
+	for _, color := range t.Namespaces {
+		if !isColorSpec(color) {
+			return fmt.Errorf("invalid namespace color %q", color)
+		}
+	}
+	for _, h := range t.Highlights {
+		if h.Pattern == nil {
+			return fmt.Errorf("empty highlight pattern")
+		}
+		if !isColorSpec(h.Color) {
+			return fmt.Errorf("invalid color %q of highlight %q", h.Color, h.Pattern)
+		}
+	}
+	return nil
+}
+
+// ParseLevelColors parses level colors like "warn=yellow+b, error=red"; "off" removes the color of a level
+func ParseLevelColors(spec string) (map[LogLevel]string, error) {
+	colors := make(map[LogLevel]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		rawLevel, color, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid level color %q, expected level=color", item)
+		}
+		level, ok := lookupLogLevel(strings.TrimSpace(rawLevel))
+		if !ok {
+			return nil, fmt.Errorf("unknown log level %q", rawLevel)
+		}
+		color = strings.TrimSpace(color)
+		if !isColorSpec(color) {
+			return nil, fmt.Errorf("invalid color %q of level %s", color, rawLevel)
+		}
+		colors[level] = color
+	}
+	return colors, nil
+}
+
+// ParseHighlight parses a highlight rule like "red+b=rejected|timeout", a color and a regular expression
+func ParseHighlight(spec string) (Highlight, error) {
+	color, pattern, ok := strings.Cut(spec, "=")
+	color = strings.TrimSpace(color)
+	if !ok || pattern == "" {
+		return Highlight{}, fmt.Errorf("invalid highlight %q, expected color=pattern", spec)
+	}
+	if !isColorSpec(color) {
+		return Highlight{}, fmt.Errorf("invalid color %q of highlight %q", color, pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Highlight{}, fmt.Errorf("invalid highlight pattern %q: %v", pattern, err)
+	}
+	return Highlight{Pattern: re, Color: color}, nil
+}
+
+// themeCodes are the escape codes of a Theme, see Theme.compile
+type themeCodes struct {
+	levels     map[LogLevel]string
+	namespaces []string
+	highlights []highlightCode
+	reset      string
+}
+
+type highlightCode struct {
+	pattern *regexp.Regexp
+	code    string
+}
+
+// compile returns the escape codes of t, or nil if t colors nothing
+func (t *Theme) compile() *themeCodes {
+	if t == nil {
+		return nil
+	}
+	tc := &themeCodes{levels: make(map[LogLevel]string), reset: ansi.ColorCode("reset")}
+	for level, color := range t.Levels {
+		if code := ansi.ColorCode(color); code != "" {
+			tc.levels[level] = code
+		}
+	}
+	for _, color := range t.Namespaces {
+		if code := ansi.ColorCode(color); code != "" {
+			tc.namespaces = append(tc.namespaces, code)
+		}
+	}
+	for _, h := range t.Highlights {
+		if code := ansi.ColorCode(h.Color); code != "" {
+			tc.highlights = append(tc.highlights, highlightCode{pattern: h.Pattern, code: code})
+		}
+	}
+	if len(tc.levels) == 0 && len(tc.namespaces) == 0 && len(tc.highlights) == 0 {
+		return nil
+	}
+	return tc
+}
+
+func (tc *themeCodes) level(level LogLevel, name string) string {
+	if code := tc.levels[level]; code != "" {
+		return code + name + tc.reset
+	}
+	return name
+}
+
+// namespace colors namespace with the color of its hash, so that it keeps its color across runs and outputs
+func (tc *themeCodes) namespace(namespace string) string {
+	if len(tc.namespaces) == 0 || namespace == "" {
+		return namespace
+	}
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return tc.namespaces[h.Sum32()%uint32(len(tc.namespaces))] + namespace + tc.reset
+}
+
+// highlight colors the parts of txt matching the highlight rules; the color tags of the inline markup are left as is
+func (tc *themeCodes) highlight(txt string) string {
+	if len(tc.highlights) == 0 {
+		return txt
+	}
+	type span struct {
+		from, to int
+		code     string
+	}
+	var spans []span
+	for _, tag := range colorTags(txt) {
+		spans = append(spans, span{from: tag[0], to: tag[1]})
+	}
+	overlaps := func(from, to int) bool {
+		for _, s := range spans {
+			if from < s.to && s.from < to {
+				return true
+			}
+		}
+		return false
+	}
+	highlighted := false
+	for _, h := range tc.highlights {
+		for _, m := range h.pattern.FindAllStringIndex(txt, -1) {
+			if m[0] == m[1] || overlaps(m[0], m[1]) {
+				continue
+			}
+			spans = append(spans, span{from: m[0], to: m[1], code: h.code})
+			highlighted = true
+		}
+	}
+	if !highlighted {
+		return txt
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from < spans[j].from })
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.code == "" {
+			continue // a color tag
+		}
+		sb.WriteString(txt[last:s.from])
+		sb.WriteString(s.code)
+		sb.WriteString(txt[s.from:s.to])
+		sb.WriteString(tc.reset)
+		last = s.to
+	}
+	sb.WriteString(txt[last:])
+	return sb.String()
+}
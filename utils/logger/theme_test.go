@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandAnsiTags(t *testing.T) {
+	red, reset := ansi.ColorCode("red"), ansi.ColorCode("reset")
+	assert.Equal(t, `{"id":1} {id} `+red+"rejected"+reset, ExpandAnsi(`{"id":1} {id} {red}rejected{reset}`))
+	assert.Equal(t, `{"id":1} {id} rejected`, StripAnsi(`{"id":1} {id} {red}rejected{reset}`))
+	assert.Equal(t, ansi.ColorCode("magenta+bh:white+h")+"long spec", ExpandAnsi("{magenta+bh:white+h}long spec"))
+	assert.Equal(t, "{red+x} {blue:bogus}", ExpandAnsi("{red+x} {blue:bogus}"))
+}
+
+func TestThemeSimpleFormatter(t *testing.T) {
+	theme, err := ThemeByName("dark")
+	require.NoError(t, err)
+	levels, err := ParseLevelColors("warn=yellow+b, debug=off")
+	require.NoError(t, err)
+	for level, color := range levels {
+		theme.Levels[level] = color
+	}
+	highlight, err := ParseHighlight("red+b=reject(ed)?")
+	require.NoError(t, err)
+	theme.Highlights = append(theme.Highlights, highlight)
+	assert.Equal(t, "yellow+h", ThemeDark.Levels[LogLevelWarn], "ThemeByName returns a copy")
+
+	f, err := NewFormatterByName("simple", FormatterOptions{Ansi: true, Theme: theme})
+	require.NoError(t, err)
+	lm := logMessage{
+		level:           LogLevelWarn,
+		unixTimestampNS: 1612345678901234567,
+		namespace:       "exch.binance",
+		message:         "order {red}rejected{reset}, reject",
+	}
+	reset := ansi.ColorCode("reset")
+	txt := f.String(lm)
+	assert.Contains(t, txt, "["+ansi.ColorCode("yellow+b")+"WARN"+reset+"]")
+	assert.Contains(t, txt, ", "+ansi.ColorCode("red+b")+"reject"+reset+reset)
+	// the color tags of the inline markup are expanded, the text between them highlighted
+	assert.Contains(t, txt, "order "+ansi.ColorCode("red")+ansi.ColorCode("red+b")+"rejected"+reset+reset+",")
+
+	// the color of a namespace is picked from the palette by a hash of the namespace
+	namespace := theme.compile().namespace("exch.binance")
+	assert.Contains(t, txt, "("+namespace+")")
+	assert.Contains(t, ThemeDark.Namespaces, "cyan")
+	assert.NotEqual(t, "exch.binance", namespace)
+	assert.Equal(t, namespace, ThemeDark.compile().namespace("exch.binance"))
+
+	lm.level = LogLevelDebug
+	assert.Contains(t, f.String(lm), "[DEBUG]")
+
+	// the theme is ignored without ansi support
+	f, err = NewFormatterByName("simple", FormatterOptions{Theme: theme})
+	require.NoError(t, err)
+	assert.Equal(t, "2021-02-03 09:47:58.901 (exch.binance) [DEBUG]: order rejected, reject", f.String(lm))
+
+	_, err = NewFormatterByName("simple", FormatterOptions{Ansi: true, Theme: &Theme{Namespaces: []string{"bogus"}}})
+	assert.Error(t, err)
+	_, err = ThemeByName("solarized")
+	assert.Error(t, err)
+	_, err = ParseHighlight("red")
+	assert.Error(t, err)
+	_, err = ParseLevelColors("verbose=red")
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeMode selects how a formatter renders the time of a message, see TimeFormat
+type TimeMode int
+
+const (
+	// TimeModeDefault is the own mode of the formatter: TimeModeSimple for the simple and template formats,
+	// TimeModeRFC3339 for logfmt, TimeModeEpoch in nanoseconds for JSON
+	TimeModeDefault TimeMode = iota
+
+	// TimeModeSimple renders "2006-01-02 15:04:05.000", with as many fractional digits as the precision, followed by
+	// the zone offset like "+09:00" out of UTC so that the time parses back
+	TimeModeSimple
+
+	// TimeModeRFC3339 renders "2006-01-02T15:04:05.000Z07:00", with as many fractional digits as the precision
+	TimeModeRFC3339
+
+	// TimeModeEpoch renders the number of precision units since the Unix epoch, e.g. milliseconds
+	TimeModeEpoch
+
+	// TimeModeLayout renders with the Go time layout of the TimeFormat; the precision is ignored
+	TimeModeLayout
+)
+
+// TimeFormat configures the time of the messages of a formatter. The zero value keeps the format of the formatter,
+// in UTC with millisecond precision (nanoseconds for JSON), on its fast path.
+type TimeFormat struct {
+	Mode      TimeMode
+	Layout    string         // Go time layout of TimeModeLayout
+	Precision time.Duration  // time.Second, Millisecond, Microsecond or Nanosecond; default of the formatter if 0
+	Location  *time.Location // UTC if nil
+}
+
+// ParseTimeFormat parses the "timeFormat" ("simple", "rfc3339", "epoch", or a Go time layout; "" or "default" for the
+// format of the formatter), "timePrecision" ("s", "ms", "us" or "ns") and "timeZone" ("UTC", "Local" or an IANA
+// name like "Asia/Tokyo") config fields
+func ParseTimeFormat(format, precision, zone string) (TimeFormat, error) {
+	var tf TimeFormat
+	switch strings.ToLower(format) {
+	case "", "default":
+	case "simple", "text":
+		tf.Mode = TimeModeSimple
+	case "rfc3339":
+		tf.Mode = TimeModeRFC3339
+	case "epoch", "unix":
+		tf.Mode = TimeModeEpoch
+	default:
+		// a layout renders another time than the reference time differently from itself
+		if otherTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); otherTime.Format(format) == format {
+			return tf, fmt.Errorf("invalid time format %q", format)
+		}
+		tf.Mode, tf.Layout = TimeModeLayout, format
+	}
+
+	switch strings.ToLower(precision) {
+	case "":
+	case "s":
+		tf.Precision = time.Second
+	case "ms":
+		tf.Precision = time.Millisecond
+	case "us", "µs":
+		tf.Precision = time.Microsecond
+	case "ns":
+		tf.Precision = time.Nanosecond
+	default:
+		return tf, fmt.Errorf("invalid time precision %q", precision)
+	}
+
+	switch strings.ToLower(zone) {
+	case "", "utc":
+	case "local":
+		tf.Location = time.Local
+	default:
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return tf, fmt.Errorf("invalid time zone %q: %v", zone, err)
+		}
+		tf.Location = loc
+	}
+	return tf, nil
+}
+
+// isDefault reports whether tf keeps the format of the formatter, so that its fast path can be used
+func (tf TimeFormat) isDefault() bool {
+	return tf.Mode == TimeModeDefault && tf.Precision == 0 && tf.Location == nil
+}
+
+// withDefaults returns tf with the default mode and precision of a formatter
+func (tf TimeFormat) withDefaults(mode TimeMode, precision time.Duration) TimeFormat {
+	if tf.Mode == TimeModeDefault {
+		tf.Mode = mode
+	}
+	if tf.Precision <= 0 {
+		tf.Precision = precision
+	}
+	if tf.Location == nil {
+		tf.Location = time.UTC
+	}
+	return tf
+}
+
+// fractionLayout returns the fractional seconds of a layout, e.g. ".000" for milliseconds
+func fractionLayout(precision time.Duration) string {
+	switch {
+	case precision >= time.Second:
+		return ""
+	case precision >= time.Millisecond:
+		return ".000"
+	case precision >= time.Microsecond:
+		return ".000000"
+	}
+	return ".000000000"
+}
+
+// format renders the time unixNanoseconds; tf must have its defaults set, see withDefaults
+func (tf TimeFormat) format(unixNanoseconds int64) string {
+	switch tf.Mode {
+	case TimeModeEpoch:
+		return strconv.FormatInt(tf.epoch(unixNanoseconds), 10)
+	case TimeModeLayout:
+		return time.Unix(0, unixNanoseconds).In(tf.Location).Format(tf.Layout)
+	case TimeModeRFC3339:
+		return time.Unix(0, unixNanoseconds).In(tf.Location).Format("2006-01-02T15:04:05" + fractionLayout(tf.Precision) + "Z07:00")
+	}
+	layout := "2006-01-02 15:04:05" + fractionLayout(tf.Precision)
+	if tf.Location != time.UTC {
+		layout += "-07:00"
+	}
+	return time.Unix(0, unixNanoseconds).In(tf.Location).Format(layout)
+}
+
+// epoch returns the number of precision units since the Unix epoch
+func (tf TimeFormat) epoch(unixNanoseconds int64) int64 {
+	if tf.Precision <= 0 {
+		return unixNanoseconds
+	}
+	return unixNanoseconds / int64(tf.Precision)
+}
+
+// parseLogTime parses a time written with a TimeFormat in the simple, RFC3339 or epoch mode; epoch units are guessed
+// from the magnitude
+func parseLogTime(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return epochTime(n), nil
+	}
+	// fractional seconds of any precision are accepted after the seconds; simple times without an offset are in UTC
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// epochTime converts a number of seconds, milliseconds, microseconds or nanoseconds since the Unix epoch to a time
+func epochTime(n int64) time.Time {
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0).UTC()
+	case n < 1e14:
+		return time.UnixMilli(n).UTC()
+	case n < 1e17:
+		return time.UnixMicro(n).UTC()
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -12,12 +12,19 @@ var FilterUnderscore = Filter(regexp.MustCompile(`^([^_]+(.*)?)?$`))
 
 // ParseLogLevel tries to parse raw into a log level, if it cant, returns defaultLevel
 func ParseLogLevel(raw string, defaultLevel LogLevel) LogLevel {
+	if level, ok := lookupLogLevel(raw); ok {
+		return level
+	}
+	return defaultLevel
+}
+
+func lookupLogLevel(raw string) (LogLevel, bool) {
 	for level, levelString := range logLevels {
 		if strings.ToLower(raw) == strings.ToLower(levelString) {
-			return level
+			return level, true
 		}
 	}
-	return defaultLevel
+	return 0, false
 }
 
 // 2020-10-15 10:28:21.333
@@ -38,6 +45,18 @@ func newLogMessage(level LogLevel, namespace, format string, a ...interface{}) l
 		level:           level,
 		namespace:       namespace,
 		message:         fmt.Sprintf(format, a...),
+		format:          format,
+		unixTimestampNS: currentClock.Now().UnixNano(),
+	}
+}
+
+func newLogMessageW(level LogLevel, namespace, message string, fields []Field) logMessage {
+	return logMessage{
+		level:           level,
+		namespace:       namespace,
+		message:         message,
+		format:          message,
+		fields:          fields,
 		unixTimestampNS: currentClock.Now().UnixNano(),
 	}
 }
@@ -300,7 +300,9 @@ func InitKeybindings(g *gocui.Gui, cmdhandler func(string)) error {
 						cmdStack = append(cmdStack, str)
 					}
 					curNdx = len(cmdStack)
-					go cmdhandler(str)
+					if !handleLogWindowCommand(str) {
+						go cmdhandler(str)
+					}
 					GlobalGui.Update(func(gui *gocui.Gui) error {
 						return nil
 					})